@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/xian/xsh/internal/config"
 )
@@ -19,9 +20,24 @@ type AnthropicProvider struct {
 }
 
 type AnthropicRequest struct {
-	Model     string             `json:"model"`
-	MaxTokens int                `json:"max_tokens"`
-	Messages  []AnthropicMessage `json:"messages"`
+	Model      string               `json:"model"`
+	MaxTokens  int                  `json:"max_tokens"`
+	System     string               `json:"system,omitempty"`
+	Messages   []AnthropicMessage   `json:"messages"`
+	Tools      []AnthropicTool      `json:"tools,omitempty"`
+	ToolChoice *AnthropicToolChoice `json:"tool_choice,omitempty"`
+	Stream     bool                 `json:"stream,omitempty"`
+}
+
+type AnthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type AnthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 type AnthropicMessage struct {
@@ -31,12 +47,45 @@ type AnthropicMessage struct {
 
 type AnthropicResponse struct {
 	Content []AnthropicContent `json:"content"`
+	Usage   *AnthropicUsage    `json:"usage,omitempty"`
 	Error   *AnthropicError    `json:"error,omitempty"`
 }
 
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
 type AnthropicContent struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type  string          `json:"type"`
+	Text  string          `json:"text"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type AnthropicStreamEvent struct {
+	Type    string             `json:"type"`
+	Message *AnthropicResponse `json:"message,omitempty"` // message_start
+	Delta   *AnthropicDelta    `json:"delta,omitempty"`
+	Usage   *AnthropicUsage    `json:"usage,omitempty"` // message_delta
+	Error   *AnthropicError    `json:"error,omitempty"`
+}
+
+type AnthropicDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	PartialJSON string `json:"partial_json,omitempty"`
+}
+
+type AnthropicModelsResponse struct {
+	Data    []AnthropicModel `json:"data"`
+	HasMore bool             `json:"has_more"`
+	LastID  string           `json:"last_id"`
+}
+
+type AnthropicModel struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	CreatedAt   string `json:"created_at"`
 }
 
 type AnthropicError struct {
@@ -44,44 +93,56 @@ type AnthropicError struct {
 	Message string `json:"message"`
 }
 
+func init() {
+	Register(ProviderSpec{
+		Name: "anthropic",
+		Factory: func(cfg config.ModelConfig) (Provider, error) {
+			return NewAnthropicProvider(cfg)
+		},
+		Schema: config.ProviderSchema{
+			Key:            "claude",
+			Priority:       10,
+			APIKeyEnv:      "ANTHROPIC_API_KEY",
+			BaseURLEnv:     "ANTHROPIC_BASE_URL",
+			DefaultBaseURL: "https://api.anthropic.com",
+			ModelEnv:       "ANTHROPIC_MODEL",
+			DefaultModel:   "claude-3-sonnet-20240229",
+		},
+		Capabilities: Capabilities{Streaming: true, ModelDiscovery: true, StructuredOutput: true},
+	})
+}
+
 func NewAnthropicProvider(cfg config.ModelConfig) (*AnthropicProvider, error) {
 	return &AnthropicProvider{
 		apiKey:  cfg.APIKey,
 		baseURL: cfg.BaseURL,
 		model:   cfg.Model,
-		client:  &http.Client{},
+		client:  httpClient(),
 	}, nil
 }
 
-func (p *AnthropicProvider) Query(ctx context.Context, prompt string) (string, error) {
-	requestBody := AnthropicRequest{
-		Model:     p.model,
-		MaxTokens: 1000,
-		Messages: []AnthropicMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-	}
+func (p *AnthropicProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	return p.chat(ctx, messages, nil)
+}
 
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
+func (p *AnthropicProvider) ChatStream(ctx context.Context, messages []Message, onChunk StreamHandler) (string, error) {
+	return p.chatStream(ctx, messages, nil, onChunk)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v1/messages", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+// ChatStructured 通过强制调用一个以 schema 为输入结构的工具来获得结构化输出
+func (p *AnthropicProvider) ChatStructured(ctx context.Context, messages []Message, schema OutputSchema, onChunk StreamHandler) (string, error) {
+	if onChunk != nil {
+		return p.chatStream(ctx, messages, &schema, onChunk)
 	}
+	return p.chat(ctx, messages, &schema)
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", p.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := p.client.Do(req)
+func (p *AnthropicProvider) chat(ctx context.Context, messages []Message, schema *OutputSchema) (string, error) {
+	resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+		return p.newRequest(ctx, messages, false, schema)
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -90,10 +151,6 @@ func (p *AnthropicProvider) Query(ctx context.Context, prompt string) (string, e
 		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var response AnthropicResponse
 	if err := json.Unmarshal(body, &response); err != nil {
 		return "", fmt.Errorf("failed to unmarshal response: %w", err)
@@ -103,25 +160,167 @@ func (p *AnthropicProvider) Query(ctx context.Context, prompt string) (string, e
 		return "", fmt.Errorf("API error: %s", response.Error.Message)
 	}
 
+	if response.Usage != nil {
+		ReportUsage(ctx, response.Usage.InputTokens, response.Usage.OutputTokens)
+	}
+
 	if len(response.Content) == 0 {
 		return "", nil
 	}
 
+	if schema != nil {
+		for _, content := range response.Content {
+			if content.Type == "tool_use" {
+				return string(content.Input), nil
+			}
+		}
+	}
+
 	return response.Content[0].Text, nil
 }
 
-func (p *AnthropicProvider) GetAvailableModels() ([]string, error) {
-	// Anthropic 不提供公开的模型列表 API，所以使用预定义的 Claude 模型
-	models := []string{
-		"claude-3-5-sonnet-20241022",
-		"claude-3-5-sonnet-20240620",
-		"claude-3-sonnet-20240229",
-		"claude-3-opus-20240229",
-		"claude-3-haiku-20240307",
-		"claude-2.1",
-		"claude-2.0",
-		"claude-instant-1.2",
+func (p *AnthropicProvider) chatStream(ctx context.Context, messages []Message, schema *OutputSchema, onChunk StreamHandler) (string, error) {
+	resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+		req, err := p.newRequest(ctx, messages, true, schema)
+		if err == nil {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+		return req, err
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	err = readSSE(resp.Body, func(event, data string) error {
+		var streamEvent AnthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &streamEvent); err != nil {
+			return fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+
+		switch streamEvent.Type {
+		case "error":
+			if streamEvent.Error != nil {
+				return fmt.Errorf("API error: %s", streamEvent.Error.Message)
+			}
+			return fmt.Errorf("API error: %s", data)
+		case "message_start":
+			if streamEvent.Message != nil && streamEvent.Message.Usage != nil {
+				ReportUsage(ctx, streamEvent.Message.Usage.InputTokens, streamEvent.Message.Usage.OutputTokens)
+			}
+		case "message_delta":
+			// message_delta 中的 output_tokens 是累计值
+			if streamEvent.Usage != nil {
+				ReportUsage(ctx, streamEvent.Usage.InputTokens, streamEvent.Usage.OutputTokens)
+			}
+		case "content_block_delta":
+			if streamEvent.Delta == nil {
+				return nil
+			}
+			// 结构化输出时只关心工具输入的 JSON 片段
+			delta := streamEvent.Delta.Text
+			if schema != nil {
+				if streamEvent.Delta.Type != "input_json_delta" {
+					return nil
+				}
+				delta = streamEvent.Delta.PartialJSON
+			} else if streamEvent.Delta.Type != "text_delta" {
+				return nil
+			}
+			text.WriteString(delta)
+			if onChunk != nil {
+				onChunk(delta)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return text.String(), err
+	}
+
+	return text.String(), nil
+}
+
+func (p *AnthropicProvider) newRequest(ctx context.Context, messages []Message, stream bool, schema *OutputSchema) (*http.Request, error) {
+	system, conversation := splitSystemMessages(messages)
+	requestBody := AnthropicRequest{
+		Model:     p.model,
+		MaxTokens: 1000,
+		System:    system,
+		Stream:    stream,
+	}
+	for _, msg := range conversation {
+		requestBody.Messages = append(requestBody.Messages, AnthropicMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+	if schema != nil {
+		requestBody.Tools = []AnthropicTool{{
+			Name:        schema.Name,
+			Description: schema.Description,
+			InputSchema: schema.Schema,
+		}}
+		requestBody.ToolChoice = &AnthropicToolChoice{Type: "tool", Name: schema.Name}
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v1/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	return models, nil
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	return req, nil
+}
+
+// GetAvailableModels 通过 /v1/models 分页获取账号可用的模型，按发布时间从新到旧排列
+func (p *AnthropicProvider) GetAvailableModels(ctx context.Context) ([]string, error) {
+	var models []string
+	afterID := ""
+	for {
+		url := p.baseURL + "/v1/models?limit=1000"
+		if afterID != "" {
+			url += "&after_id=" + afterID
+		}
+		resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create request: %w", err)
+			}
+			req.Header.Set("x-api-key", p.apiKey)
+			req.Header.Set("anthropic-version", "2023-06-01")
+			return req, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		var response AnthropicModelsResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+
+		for _, model := range response.Data {
+			models = append(models, model.ID)
+		}
+		if !response.HasMore || response.LastID == "" {
+			return models, nil
+		}
+		afterID = response.LastID
+	}
 }
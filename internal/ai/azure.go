@@ -0,0 +1,127 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/xian/xsh/internal/config"
+)
+
+const (
+	// azureDefaultAPIVersion 是对话请求默认使用的 API 版本，支持结构化输出和流式用量统计
+	azureDefaultAPIVersion = "2024-10-21"
+	// azureDeploymentsAPIVersion 是列出部署时使用的 API 版本，新版本的数据面 API 不再提供部署列表
+	azureDeploymentsAPIVersion = "2022-12-01"
+)
+
+// AzureOpenAIProvider 访问 Azure OpenAI 服务。请求格式与 OpenAI 相同，
+// 但按部署名称路由（/openai/deployments/{deployment}/...），使用 api-key 头认证并需要 api-version 参数
+type AzureOpenAIProvider struct {
+	*OpenAIProvider
+	endpoint string
+}
+
+type AzureDeploymentsResponse struct {
+	Data []AzureDeployment `json:"data"`
+}
+
+type AzureDeployment struct {
+	ID     string `json:"id"`    // 部署名称
+	Model  string `json:"model"` // 部署的底层模型，如 "gpt-4o"
+	Status string `json:"status"`
+}
+
+func init() {
+	Register(ProviderSpec{
+		Name: "azure",
+		Factory: func(cfg config.ModelConfig) (Provider, error) {
+			return NewAzureOpenAIProvider(cfg)
+		},
+		Schema: config.ProviderSchema{
+			Key:              "azure",
+			Priority:         35,
+			APIKeyEnv:        "AZURE_OPENAI_API_KEY",
+			BaseURLEnv:       "AZURE_OPENAI_ENDPOINT",
+			ModelEnv:         "AZURE_OPENAI_DEPLOYMENT",
+			RequiredEnv:      []string{"AZURE_OPENAI_ENDPOINT", "AZURE_OPENAI_DEPLOYMENT"},
+			NormalizeBaseURL: azureEndpoint,
+			Options: []config.ProviderOption{
+				{Name: "api-version", Env: "AZURE_OPENAI_API_VERSION", Default: azureDefaultAPIVersion},
+			},
+		},
+		Capabilities: Capabilities{Streaming: true, ModelDiscovery: true, StructuredOutput: true},
+	})
+}
+
+// NewAzureOpenAIProvider 创建 Azure OpenAI 提供商，cfg.Model 是部署名称
+func NewAzureOpenAIProvider(cfg config.ModelConfig) (*AzureOpenAIProvider, error) {
+	endpoint := azureEndpoint(cfg.BaseURL)
+	if endpoint == "" {
+		return nil, fmt.Errorf("azure: AZURE_OPENAI_ENDPOINT is not set")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("azure: AZURE_OPENAI_DEPLOYMENT is not set")
+	}
+
+	apiVersion := cfg.Options["api-version"]
+	if apiVersion == "" {
+		apiVersion = azureDefaultAPIVersion
+	}
+
+	openai, err := NewOpenAIProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	openai.chatURL = fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		endpoint, url.PathEscape(cfg.Model), url.QueryEscape(apiVersion))
+	openai.authorize = func(req *http.Request) {
+		req.Header.Set("api-key", cfg.APIKey)
+	}
+
+	return &AzureOpenAIProvider{OpenAIProvider: openai, endpoint: endpoint}, nil
+}
+
+// azureEndpoint 规范化资源地址，如 "https://my-resource.openai.azure.com/"
+func azureEndpoint(endpoint string) string {
+	return strings.TrimRight(strings.TrimSpace(endpoint), "/")
+}
+
+// GetAvailableModels 列出资源中已成功创建的部署，模型选择器中显示的是部署名称
+func (p *AzureOpenAIProvider) GetAvailableModels(ctx context.Context) ([]string, error) {
+	listURL := fmt.Sprintf("%s/openai/deployments?api-version=%s", p.endpoint, azureDeploymentsAPIVersion)
+	resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", listURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		p.authorize(req)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var response AzureDeploymentsResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var deployments []string
+	for _, deployment := range response.Data {
+		if deployment.Status == "" || deployment.Status == "succeeded" {
+			deployments = append(deployments, deployment.ID)
+		}
+	}
+	return deployments, nil
+}
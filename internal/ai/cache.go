@@ -0,0 +1,186 @@
+package ai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xian/xsh/internal/config"
+)
+
+// responseCache 把查询结果按内容哈希保存在磁盘上，相同的问题可以立即得到回答
+type responseCache struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+}
+
+type cacheEntry struct {
+	Created  time.Time `json:"created"`
+	Response Response  `json:"response"`
+}
+
+// newResponseCache 根据配置创建缓存，未启用时返回 nil
+func newResponseCache(cfg *config.Config) *responseCache {
+	if !cfg.Cache.Enabled || cfg.CacheDir == "" {
+		return nil
+	}
+	return &responseCache{
+		dir:      filepath.Join(cfg.CacheDir, "responses"),
+		ttl:      cfg.Cache.TTL,
+		maxBytes: cfg.Cache.MaxBytes,
+	}
+}
+
+// cacheKey 由提供商、模型、请求类型、规范化后的对话（之前的轮次和当前问题）、本机文档摘录和 context 计算缓存键。
+// 系统提示中的当前目录等随会话变化的内容不计入，同一段对话在新的会话或其他目录中也能命中；
+// "只看 src/" 这类追问则只会命中同一段对话之后的缓存
+func cacheKey(modelConfig config.ModelConfig, req chatRequest, context string) string {
+	h := sha256.New()
+	write := func(parts ...string) {
+		for _, part := range parts {
+			h.Write([]byte(part))
+			h.Write([]byte{0})
+		}
+	}
+
+	mode := "chat"
+	if req.suggest {
+		mode = "suggest"
+	}
+	write(modelConfig.Provider, modelConfig.Model, mode)
+	for _, msg := range req.messages {
+		// 系统提示由 context 代表
+		if msg.Role == RoleSystem {
+			continue
+		}
+		write(msg.Role, normalizePrompt(msg.Content))
+	}
+	write(req.grounding, context)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheContext 返回影响回答、但在会话之间保持不变的上下文：本机环境的探测结果和生效的提示模板。
+// 环境或模板变化后不会命中旧的缓存
+func (c *Client) cacheContext() string {
+	env := config.ProbeEnvironment()
+	parts := []string{env.Description(), env.PackageManager, env.ToolSummary()}
+
+	dir := c.cwd
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	for _, path := range c.config.PromptFiles(dir) {
+		if text, err := os.ReadFile(path); err == nil {
+			parts = append(parts, string(text))
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// normalizePrompt 忽略大小写和多余空白，使 "List  ports" 与 "list ports" 命中同一条缓存
+func normalizePrompt(prompt string) string {
+	return strings.Join(strings.Fields(strings.ToLower(prompt)), " ")
+}
+
+func (c *responseCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// Get 读取未过期的缓存结果
+func (c *responseCache) Get(key string) (Response, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return Response{}, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		os.Remove(c.path(key))
+		return Response{}, false
+	}
+	if c.ttl > 0 && time.Since(entry.Created) > c.ttl {
+		os.Remove(c.path(key))
+		return Response{}, false
+	}
+	return entry.Response, true
+}
+
+// Put 写入缓存并在超出容量上限时淘汰最旧的条目，写入失败不影响查询
+func (c *responseCache) Put(key string, response Response) {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return
+	}
+
+	data, err := json.Marshal(cacheEntry{Created: time.Now(), Response: response})
+	if err != nil {
+		return
+	}
+
+	// 先写临时文件再重命名，避免并发的 xsh 会话读到写了一半的条目
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, writeErr := tmp.Write(data)
+	closeErr := tmp.Close()
+	if writeErr != nil || closeErr != nil || os.Rename(tmp.Name(), c.path(key)) != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	c.prune()
+}
+
+// prune 删除过期条目，并从最旧的开始删除直到总大小不超过 maxBytes
+func (c *responseCache) prune() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+
+	type cacheFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cacheFile
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(c.dir, entry.Name())
+		if c.ttl > 0 && time.Since(info.ModTime()) > c.ttl {
+			os.Remove(path)
+			continue
+		}
+		files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+
+	if c.maxBytes <= 0 || total <= c.maxBytes {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, file := range files {
+		if total <= c.maxBytes {
+			break
+		}
+		if os.Remove(file.path) == nil {
+			total -= file.size
+		}
+	}
+}
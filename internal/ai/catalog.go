@@ -0,0 +1,120 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xian/xsh/internal/config"
+)
+
+// catalogRefreshTimeout 是后台刷新模型列表的超时时间
+const catalogRefreshTimeout = 30 * time.Second
+
+// modelCatalog 在磁盘上缓存各提供商的模型列表，使模型选择器可以立即打开并在离线时使用。
+// 过期的列表仍会返回，同时在后台重新获取
+type modelCatalog struct {
+	dir        string
+	ttl        time.Duration
+	mu         sync.Mutex
+	refreshing map[string]bool
+}
+
+type catalogEntry struct {
+	Fetched time.Time `json:"fetched"`
+	Models  []string  `json:"models"`
+}
+
+// newModelCatalog 根据配置创建模型列表缓存，没有缓存目录时返回 nil
+func newModelCatalog(cfg *config.Config) *modelCatalog {
+	if cfg.CacheDir == "" {
+		return nil
+	}
+	return &modelCatalog{
+		dir:        filepath.Join(cfg.CacheDir, "models"),
+		ttl:        cfg.Cache.CatalogTTL,
+		refreshing: make(map[string]bool),
+	}
+}
+
+// catalogKey 区分提供商、服务地址和密钥，不同账号可见的模型可能不同
+func catalogKey(modelConfig config.ModelConfig) string {
+	h := sha256.New()
+	for _, part := range []string{modelConfig.Provider, modelConfig.BaseURL, modelConfig.APIKey} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return modelConfig.Provider + "-" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func (c *modelCatalog) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// Get 读取缓存的模型列表，stale 表示已超过刷新间隔
+func (c *modelCatalog) Get(key string) (models []string, stale bool, ok bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false, false
+	}
+
+	var entry catalogEntry
+	if err := json.Unmarshal(data, &entry); err != nil || len(entry.Models) == 0 {
+		os.Remove(c.path(key))
+		return nil, false, false
+	}
+	return entry.Models, time.Since(entry.Fetched) > c.ttl, true
+}
+
+// Put 写入模型列表，写入失败不影响模型选择
+func (c *modelCatalog) Put(key string, models []string) {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return
+	}
+
+	data, err := json.Marshal(catalogEntry{Fetched: time.Now(), Models: models})
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, writeErr := tmp.Write(data)
+	closeErr := tmp.Close()
+	if writeErr != nil || closeErr != nil || os.Rename(tmp.Name(), c.path(key)) != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// Refresh 在后台重新获取模型列表，同一个 key 同时只会有一次刷新
+func (c *modelCatalog) Refresh(key string, fetch func(ctx context.Context) ([]string, error)) {
+	c.mu.Lock()
+	if c.refreshing[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), catalogRefreshTimeout)
+		defer cancel()
+		// 离线或请求失败时保留旧的列表，下次打开选择器时再试
+		if models, err := fetch(ctx); err == nil && len(models) > 0 {
+			c.Put(key, models)
+		}
+	}()
+}
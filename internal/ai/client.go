@@ -4,91 +4,446 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/xian/xsh/internal/config"
+	"github.com/xian/xsh/internal/redact"
+	"github.com/xian/xsh/internal/usage"
 )
 
+// maxHistoryMessages 限制会话中保留的历史消息条数
+const maxHistoryMessages = 20
+
 type Client struct {
-	config *config.Config
+	config  *config.Config
+	history []Message
+	cache   *responseCache
+	catalog *modelCatalog
+	usage   *accountant
+	// cwd 是子 shell 的当前目录，用于渲染系统提示和查找目录级的提示模板
+	cwd string
+	// redactor 替换发往提供商的内容中的密钥，为 nil 时不脱敏；
+	// redactErr 是加载自定义规则时的错误，此时拒绝发送任何请求
+	redactor  *redact.Redactor
+	redactErr error
+
+	// unstructured 记录本次会话中拒绝了结构化输出参数的模型（提供商/模型名）
+	unstructuredMu sync.Mutex
+	unstructured   map[string]bool
 }
 
 type Provider interface {
-	Query(ctx context.Context, prompt string) (string, error)
-	GetAvailableModels() ([]string, error)
+	// Chat 发送一组按顺序排列的对话消息，返回助手的回复
+	Chat(ctx context.Context, messages []Message) (string, error)
+	// ChatStream 以流式方式发送对话，每收到一段增量文本就调用 onChunk，最终返回完整文本
+	ChatStream(ctx context.Context, messages []Message, onChunk StreamHandler) (string, error)
+	// GetAvailableModels 返回提供商可用的模型名称
+	GetAvailableModels(ctx context.Context) ([]string, error)
 }
 
 func New(cfg *config.Config) *Client {
-	return &Client{
-		config: cfg,
+	c := &Client{
+		config:  cfg,
+		cache:   newResponseCache(cfg),
+		catalog: newModelCatalog(cfg),
+		usage:   newAccountant(cfg),
+	}
+	if cfg.Redact.Enabled {
+		patterns, err := redact.LoadPatterns(cfg.Redact.PatternsFile)
+		c.redactor, c.redactErr = redact.New(patterns, cfg.Redact.Entropy), err
+	}
+	return c
+}
+
+// Response 是一次查询的结果，记录实际给出回答的模型
+type Response struct {
+	Text       string
+	Provider   string
+	Model      string
+	Fallback   bool // 主模型失败后由回退链中的模型回答
+	Hedged     bool // 主模型回复过慢，由对冲请求的备用模型先给出了回答
+	Structured bool // Text 是按 JSON schema 输出的结构化结果
+	Cached     bool // 结果来自磁盘缓存
+
+	Usage  usage.Tokens // 提供商报告的 token 用量，缓存命中时为零
+	Cost   float64      // 按价格表计算的费用（美元）
+	Priced bool         // 价格表中是否有该模型，为 false 时 Cost 无意义
+}
+
+// SuggestResponse 是一次命令建议的结果
+type SuggestResponse struct {
+	Response
+	Suggestion Suggestion
+	Parsed     bool // 是否解析出了命令；为 false 时 Text 是模型的原始回复
+	// Answers 是共识模式下每个模型各自的结果，普通请求时为空
+	Answers []ModelAnswer
+	// Reasked 表示第一次回答使用了本机文档中没有的选项，已附上文档重新询问
+	Reasked bool
+}
+
+// chatRequest 描述一次发往提供商的对话请求
+type chatRequest struct {
+	messages []Message
+	// suggest 为 true 时请求命令建议：messages 不含系统提示，由 send 根据提供商能力
+	// 选择结构化输出或文本标记格式，onChunk 只接收建议说明（message）部分的增量文本
+	suggest bool
+	onChunk StreamHandler
+	// grounding 是附加在建议请求系统提示之后的本机文档摘录
+	grounding string
+	// cache 为 true 时先查询磁盘缓存，成功的结果写回缓存；refresh 表示跳过读取、强制重新生成
+	cache   bool
+	refresh bool
+}
+
+// Query 在当前会话中提出一个问题，之前的问答会作为上下文一并发送。
+// 取消 ctx 会中止正在进行的请求
+func (c *Client) Query(ctx context.Context, prompt string) (Response, error) {
+	return c.QueryStream(ctx, prompt, nil)
+}
+
+// QueryStream 与 Query 相同，但会在响应到达时通过 onChunk 逐段回调
+func (c *Client) QueryStream(ctx context.Context, prompt string, onChunk StreamHandler) (Response, error) {
+	modelConfig, err := c.currentModel()
+	if err != nil {
+		return Response{}, err
+	}
+	system, err := c.systemPrompt(modelConfig, false)
+	if err != nil {
+		return Response{}, err
 	}
+	messages := withSystemPrompt(withGrounding(system, c.grounding(ctx, prompt)), c.history)
+	messages = append(messages, Message{Role: RoleUser, Content: prompt})
+
+	response, err := c.do(ctx, chatRequest{messages: messages, onChunk: onChunk, cache: true})
+	if err != nil {
+		return response, err
+	}
+
+	c.remember(prompt, response.Text)
+	return response, nil
 }
 
-func (c *Client) Query(prompt string) (string, error) {
-	// 确保选择了正确的模型
-	if !c.config.HasAnthropicKey() && !c.config.HasGoogleKey() && !c.config.HasOpenAIKey() {
-		return "", fmt.Errorf("no valid API key found. Please set one of: OPENAI_API_KEY, ANTHROPIC_API_KEY, or GOOGLE_API_KEY")
+// Suggest 在当前会话中请求命令建议。支持结构化输出的提供商通过 JSON schema 返回，
+// 其他提供商使用 USER_MESSAGE / SHELL_COMMANDS 文本格式；onMessage 不为 nil 时流式接收说明文字
+func (c *Client) Suggest(ctx context.Context, prompt string, onMessage StreamHandler) (SuggestResponse, error) {
+	return c.suggest(ctx, c.history, prompt, onMessage, false)
+}
+
+// Regenerate 跳过缓存重新请求上一次的建议，新的回答会替换会话历史中的上一轮。
+// 请求失败或被取消时会话历史保持不变
+func (c *Client) Regenerate(ctx context.Context, onMessage StreamHandler) (SuggestResponse, error) {
+	if len(c.history) < 2 {
+		return SuggestResponse{}, fmt.Errorf("no previous question to regenerate")
 	}
+	prompt := c.history[len(c.history)-2].Content
+	// 限制容量，避免追加新的一轮时覆盖 c.history 中的上一轮
+	history := c.history[: len(c.history)-2 : len(c.history)-2]
+	return c.suggest(ctx, history, prompt, onMessage, true)
+}
 
-	// 优先级：Anthropic > Google > OpenAI
-	if c.config.HasAnthropicKey() {
-		c.config.SetCurrentModel("claude")
-	} else if c.config.HasGoogleKey() {
-		c.config.SetCurrentModel("gemini")
-	} else if c.config.HasOpenAIKey() {
-		c.config.SetCurrentModel("openai")
+// suggest 以 history 作为之前的对话请求建议，成功后会话历史变为 history 加上这一轮问答
+func (c *Client) suggest(ctx context.Context, history []Message, prompt string, onMessage StreamHandler, refresh bool) (SuggestResponse, error) {
+	messages := append([]Message(nil), history...)
+	messages = append(messages, Message{Role: RoleUser, Content: prompt})
+	req := chatRequest{
+		messages:  messages,
+		suggest:   true,
+		onChunk:   onMessage,
+		cache:     true,
+		refresh:   refresh,
+		grounding: c.grounding(ctx, prompt),
+	}
+
+	if models := c.consensusModels(); len(models) >= 2 {
+		response, err := c.consensus(ctx, models, req)
+		if err == nil {
+			c.checkFlags(ctx, &response.Suggestion)
+			assessRisks(&response.Suggestion)
+			c.history = history
+			c.remember(prompt, response.Text)
+		}
+		return response, err
+	}
+
+	response, err := c.do(ctx, req)
+	if err != nil {
+		return SuggestResponse{Response: response}, err
+	}
+
+	suggestion, ok := ParseSuggestion(response.Text)
+	result := SuggestResponse{Response: response, Suggestion: suggestion, Parsed: ok}
+	if ok && c.checkFlags(ctx, &result.Suggestion) && c.config.Grounding.Reask {
+		result = c.reask(ctx, req, prompt, result)
+	}
+	assessRisks(&result.Suggestion)
+
+	c.history = history
+	c.remember(prompt, result.Text)
+	return result, nil
+}
+
+// remember 把一轮问答加入会话历史
+func (c *Client) remember(prompt, answer string) {
+	c.history = append(c.history,
+		Message{Role: RoleUser, Content: prompt},
+		Message{Role: RoleAssistant, Content: answer},
+	)
+	if len(c.history) > maxHistoryMessages {
+		c.history = c.history[len(c.history)-maxHistoryMessages:]
+	}
+}
+
+// Chat 直接发送一组对话消息，不读取也不记录会话历史
+func (c *Client) Chat(ctx context.Context, messages []Message) (Response, error) {
+	return c.ChatStream(ctx, messages, nil)
+}
+
+// ChatStream 与 Chat 相同，onChunk 不为 nil 时使用流式响应
+func (c *Client) ChatStream(ctx context.Context, messages []Message, onChunk StreamHandler) (Response, error) {
+	return c.do(ctx, chatRequest{messages: messages, onChunk: onChunk})
+}
+
+// do 使用当前模型发送请求，按需读写磁盘缓存
+func (c *Client) do(ctx context.Context, req chatRequest) (Response, error) {
+	modelConfig, err := c.currentModel()
+	if err != nil {
+		return Response{}, err
+	}
+	return c.cached(modelConfig, req, func() (Response, error) {
+		if backups := c.hedgeModels(modelConfig); len(backups) > 0 {
+			return c.hedge(ctx, modelConfig, backups, req)
+		}
+		return c.tryModels(ctx, modelConfig, req)
+	})
+}
+
+// currentModel 返回用户当前选择的模型（XSH_MODEL 或运行时在模型选择器中的选择）
+func (c *Client) currentModel() (config.ModelConfig, error) {
+	envHint := strings.Join(config.ProviderEnvVars(), ", ")
+	if !c.config.HasModels() {
+		return config.ModelConfig{}, fmt.Errorf("no valid API key found. Please set one of: %s", envHint)
 	}
 
 	modelConfig, exists := c.config.GetCurrentModel()
 	if !exists {
-		return "", fmt.Errorf("no AI model configured. Please set one of: OPENAI_API_KEY, ANTHROPIC_API_KEY, or GOOGLE_API_KEY")
+		return config.ModelConfig{}, fmt.Errorf("no AI model configured. Please set one of: %s", envHint)
 	}
+	return modelConfig, nil
+}
 
-	ctx := context.Background()
+// cached 在 req.cache 为 true 时先查询 modelConfig 对应的缓存，未命中时调用 fetch 并写回成功的结果
+func (c *Client) cached(modelConfig config.ModelConfig, req chatRequest, fetch func() (Response, error)) (Response, error) {
+	if !req.cache || c.cache == nil {
+		return fetch()
+	}
 
-	var provider Provider
-	var err error
+	key := cacheKey(modelConfig, req, c.cacheContext())
+	if !req.refresh {
+		if response, ok := c.cache.Get(key); ok {
+			// 缓存命中不产生费用
+			response.Cached = true
+			response.Usage, response.Cost, response.Priced = usage.Tokens{}, 0, false
+			return response, nil
+		}
+	}
 
-	switch modelConfig.Provider {
-	case "anthropic":
-		provider, err = NewAnthropicProvider(modelConfig)
-	case "google":
-		provider, err = NewGoogleProvider(modelConfig)
-	case "openai":
-		provider, err = NewOpenAIProvider(modelConfig)
-	default:
-		return "", fmt.Errorf("unsupported AI provider: %s", modelConfig.Provider)
+	response, err := fetch()
+	if err == nil && strings.TrimSpace(response.Text) != "" && !c.sensitive(response) {
+		c.cache.Put(key, response)
 	}
+	return response, err
+}
 
-	if err != nil {
-		return "", fmt.Errorf("failed to create AI provider: %w", err)
+// sensitive 表示回复中含有脱敏后又换回原值的密钥。这样的结果不写入磁盘缓存，
+// 避免密钥以明文保存在缓存目录中
+func (c *Client) sensitive(response Response) bool {
+	return c.redactor != nil && c.redactor.Contains(response.Text)
+}
+
+// tryModels 先使用 modelConfig 发送请求，失败时按 XSH_FALLBACK 配置的回退链依次尝试
+func (c *Client) tryModels(ctx context.Context, modelConfig config.ModelConfig, req chatRequest) (Response, error) {
+	// 记录是否已经向调用方输出过内容，输出过之后不再回退，避免两个模型的回答混在一起
+	streamed := false
+	if onChunk := req.onChunk; onChunk != nil {
+		req.onChunk = func(chunk string) {
+			streamed = true
+			onChunk(chunk)
+		}
 	}
 
-	// 构建完整的提示词
-	systemPrompt := config.GetSystemPrompt()
-	fullPrompt := fmt.Sprintf("%s\n\nUser: %s", systemPrompt, prompt)
+	response, err := c.send(ctx, modelConfig, req)
+	if err == nil {
+		return response, nil
+	}
 
-	response, err := provider.Query(ctx, fullPrompt)
+	var errs []string
+	lastModel := modelConfig.Model
+	for _, link := range c.config.Fallbacks {
+		// 调用方已经取消时不再尝试其他模型
+		if ctx.Err() != nil {
+			break
+		}
+		if streamed || !link.Matches(ClassifyError(err).String()) {
+			continue
+		}
 
-	// 如果是模型不可用错误，尝试使用备用模型
-	if err != nil && modelConfig.Provider == "openai" &&
-		(strings.Contains(err.Error(), "model_not_found") ||
-			strings.Contains(err.Error(), "does not exist")) {
+		linkConfig, exists := c.config.ResolveModel(link.Name, link.Model)
+		if !exists || (linkConfig.Provider == modelConfig.Provider && linkConfig.Model == modelConfig.Model) {
+			continue
+		}
 
-		// 尝试使用 gpt-3.5-turbo 作为备用
-		backupConfig := modelConfig
-		backupConfig.Model = "gpt-3.5-turbo"
+		errs = append(errs, fmt.Sprintf("%s: %v", lastModel, err))
+		lastModel = linkConfig.Model
+		response, err = c.send(ctx, linkConfig, req)
+		if err == nil {
+			response.Fallback = true
+			return response, nil
+		}
+	}
 
-		backupProvider, backupErr := NewOpenAIProvider(backupConfig)
-		if backupErr == nil {
-			response, err = backupProvider.Query(ctx, fullPrompt)
-			if err == nil {
-				// 成功使用备用模型，更新配置
-				modelConfig.Model = "gpt-3.5-turbo"
+	if len(errs) == 0 {
+		return response, err
+	}
+	return response, fmt.Errorf("all models failed: %s; %s: %w", strings.Join(errs, "; "), lastModel, err)
+}
+
+// send 使用 modelConfig 发送一次对话请求并记录 token 用量和费用。失败或被取消的请求
+// （重试后仍失败、回退前的尝试、对冲中落选的请求）只要提供商报告了用量，同样记录
+func (c *Client) send(ctx context.Context, modelConfig config.ModelConfig, req chatRequest) (Response, error) {
+	response := Response{Provider: modelConfig.Provider, Model: modelConfig.Model}
+	ctx, recorder := withUsageRecorder(ctx)
+
+	// 每个模型单独计算超时，超时后仍可以按回退链尝试下一个模型
+	if c.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+		defer cancel()
+	}
+
+	var err error
+	response.Text, response.Structured, err = c.chat(ctx, modelConfig, req)
+	response.Usage = recorder.Tokens()
+	if err != nil {
+		if !response.Usage.IsZero() {
+			c.usage.record(&response, true)
+		}
+		return response, err
+	}
+
+	c.usage.record(&response, false)
+	return response, nil
+}
+
+// chat 通过注册表创建提供商并发送请求，返回的 structured 表示是否使用了结构化输出
+func (c *Client) chat(ctx context.Context, modelConfig config.ModelConfig, req chatRequest) (text string, structured bool, err error) {
+	// 自定义的脱敏规则有误时不发送请求，避免密钥在用户以为已脱敏的情况下发出
+	if c.redactErr != nil {
+		return "", false, c.redactErr
+	}
+	provider, spec, err := newProvider(modelConfig)
+	if err != nil {
+		return "", false, err
+	}
+	provider = c.redacting(provider)
+
+	// 结构化请求被拒绝而文本格式成功时，记住该模型不支持结构化输出，之后直接使用文本格式
+	fellBack := false
+	defer func() {
+		if fellBack && err == nil {
+			c.setUnstructured(modelConfig)
+		}
+	}()
+
+	if req.suggest {
+		structuredProvider, ok := provider.(StructuredProvider)
+		if ok && c.structuredOutput(spec, modelConfig) {
+			system, err := c.systemPrompt(modelConfig, true)
+			if err != nil {
+				return "", false, err
+			}
+			messages := withSystemPrompt(withGrounding(system, req.grounding), req.messages)
+			var onChunk StreamHandler
+			if req.onChunk != nil {
+				onChunk = newJSONMessageStreamer(req.onChunk).Feed
 			}
+			text, err = structuredProvider.ChatStructured(ctx, messages, suggestionSchema, onChunk)
+			// 部分模型不支持结构化输出参数（如较旧的 OpenAI 模型），此时退回文本格式
+			if err == nil || ClassifyError(err) != ErrorBadRequest {
+				return text, true, err
+			}
+			fellBack = true
+		}
+
+		system, err := c.systemPrompt(modelConfig, false)
+		if err != nil {
+			return "", false, err
+		}
+		req.messages = withSystemPrompt(withGrounding(system, req.grounding), req.messages)
+		if onMessage := req.onChunk; onMessage != nil {
+			req.onChunk = (&textMessageStreamer{emit: onMessage}).Feed
 		}
 	}
 
-	return response, err
+	if req.onChunk == nil {
+		text, err = provider.Chat(ctx, req.messages)
+		return text, false, err
+	}
+	if !spec.Capabilities.Streaming {
+		// 不支持流式的提供商一次性返回完整响应
+		text, err = provider.Chat(ctx, req.messages)
+		if err == nil {
+			req.onChunk(text)
+		}
+		return text, false, err
+	}
+	text, err = provider.ChatStream(ctx, req.messages, req.onChunk)
+	return text, false, err
+}
+
+// structuredOutput 判断是否对 modelConfig 使用结构化输出
+func (c *Client) structuredOutput(spec ProviderSpec, modelConfig config.ModelConfig) bool {
+	if !spec.Capabilities.StructuredOutput {
+		return false
+	}
+	if model := spec.Capabilities.StructuredModel; model != nil && !model(modelConfig.Model) {
+		return false
+	}
+	c.unstructuredMu.Lock()
+	defer c.unstructuredMu.Unlock()
+	return !c.unstructured[modelConfig.Provider+"/"+modelConfig.Model]
+}
+
+// setUnstructured 记住 modelConfig 不支持结构化输出
+func (c *Client) setUnstructured(modelConfig config.ModelConfig) {
+	c.unstructuredMu.Lock()
+	defer c.unstructuredMu.Unlock()
+	if c.unstructured == nil {
+		c.unstructured = make(map[string]bool)
+	}
+	c.unstructured[modelConfig.Provider+"/"+modelConfig.Model] = true
+}
+
+// systemPrompt 用 modelConfig 对应的变量渲染系统提示模板
+func (c *Client) systemPrompt(modelConfig config.ModelConfig, structured bool) (string, error) {
+	return c.config.SystemPrompt(c.config.PromptData(modelConfig, c.cwd), structured)
+}
+
+// SetWorkingDir 设置子 shell 的当前目录，应在发起请求之前调用
+func (c *Client) SetWorkingDir(dir string) {
+	c.cwd = dir
+}
+
+// withGrounding 把本机文档摘录附加在系统提示之后
+func withGrounding(system, grounding string) string {
+	if grounding == "" {
+		return system
+	}
+	return system + "\n\n" + grounding
+}
+
+// withSystemPrompt 在对话前加上一条系统提示
+func withSystemPrompt(system string, messages []Message) []Message {
+	return append([]Message{{Role: RoleSystem, Content: system}}, messages...)
 }
 
 func (c *Client) SwitchModel(modelName string) error {
@@ -122,57 +477,79 @@ func (c *Client) GetAvailableModels() []string {
 	return models
 }
 
-func (c *Client) GetAvailableModelInfos() []config.ModelInfo {
+// GetAvailableModelInfos 获取所有已配置提供商的模型，取消 ctx 时未完成的提供商退回到已配置的模型
+func (c *Client) GetAvailableModelInfos(ctx context.Context) []config.ModelInfo {
 	var allModels []config.ModelInfo
 
 	// 为每个配置的提供商获取实时模型列表
-	modelConfig, exists := c.config.GetCurrentModel()
-	if !exists {
-		return allModels
+	for _, key := range c.config.GetAvailableModels() {
+		allModels = append(allModels, c.providerModelInfos(ctx, c.config.Models[key])...)
 	}
-	var provider Provider
-	var err error
+	return allModels
+}
 
-	switch modelConfig.Provider {
-	case "openai":
-		provider, err = NewOpenAIProvider(modelConfig)
-	case "anthropic":
-		provider, err = NewAnthropicProvider(modelConfig)
-	case "google":
-		provider, err = NewGoogleProvider(modelConfig)
-	default:
-		return allModels
-	}
+// providerModelInfos 获取单个提供商的模型列表，失败时退回到已配置的模型
+func (c *Client) providerModelInfos(ctx context.Context, modelConfig config.ModelConfig) []config.ModelInfo {
+	fallback := []config.ModelInfo{{
+		Key:         modelConfig.Model,
+		DisplayName: modelConfig.Model,
+		Provider:    modelConfig.Provider,
+	}}
 
+	provider, spec, err := newProvider(modelConfig)
 	if err != nil {
 		// 如果创建提供商失败，使用默认模型
-		allModels = append(allModels, config.ModelInfo{
-			Key:         modelConfig.Model,
-			DisplayName: modelConfig.Model,
-			Provider:    modelConfig.Provider,
-		})
-		return allModels
+		return fallback
 	}
 
-	// 获取实时模型列表
-	models, err := provider.GetAvailableModels()
-	if err != nil {
+	models, err := c.catalogModels(ctx, modelConfig, provider, spec)
+	if err != nil || len(models) == 0 {
 		// 如果获取失败，使用默认模型
-		allModels = append(allModels, config.ModelInfo{
-			Key:         modelConfig.Model,
-			DisplayName: modelConfig.Model,
-			Provider:    modelConfig.Provider,
-		})
-		return allModels
+		return fallback
 	}
 
 	// 为每个模型创建 ModelInfo
+	var infos []config.ModelInfo
 	for _, model := range models {
-		allModels = append(allModels, config.ModelInfo{
+		infos = append(infos, config.ModelInfo{
 			Key:         modelConfig.Provider + "-" + model, // 使用组合键
 			DisplayName: model,
 			Provider:    modelConfig.Provider,
 		})
 	}
-	return allModels
+	return infos
+}
+
+// catalogModels 优先使用磁盘上缓存的模型列表，过期时在后台刷新；
+// 没有缓存时才同步查询提供商
+func (c *Client) catalogModels(ctx context.Context, modelConfig config.ModelConfig, provider Provider, spec ProviderSpec) ([]string, error) {
+	if c.catalog == nil || !spec.Capabilities.ModelDiscovery {
+		return c.fetchModels(ctx, provider)
+	}
+
+	key := catalogKey(modelConfig)
+	if models, stale, ok := c.catalog.Get(key); ok {
+		if stale {
+			c.catalog.Refresh(key, func(ctx context.Context) ([]string, error) {
+				return provider.GetAvailableModels(ctx)
+			})
+		}
+		return models, nil
+	}
+
+	models, err := c.fetchModels(ctx, provider)
+	if err == nil && len(models) > 0 {
+		c.catalog.Put(key, models)
+	}
+	return models, err
+}
+
+// fetchModels 查询提供商的实时模型列表
+func (c *Client) fetchModels(ctx context.Context, provider Provider) ([]string, error) {
+	if c.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+		defer cancel()
+	}
+	return provider.GetAvailableModels(ctx)
 }
@@ -0,0 +1,151 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xian/xsh/internal/config"
+)
+
+// ModelAnswer 是共识模式下单个模型的回答
+type ModelAnswer struct {
+	SuggestResponse
+	Err error // 该模型请求失败的原因，成功时为 nil
+}
+
+// consensusModels 解析 XSH_CONSENSUS 中已配置的模型，忽略未配置或重复的条目
+func (c *Client) consensusModels() []config.ModelConfig {
+	var models []config.ModelConfig
+	for _, ref := range c.config.Consensus {
+		modelConfig, exists := c.config.ResolveModel(ref.Name, ref.Model)
+		if !exists {
+			continue
+		}
+		if slices.ContainsFunc(models, func(m config.ModelConfig) bool {
+			return m.Provider == modelConfig.Provider && m.Model == modelConfig.Model
+		}) {
+			continue
+		}
+		models = append(models, modelConfig)
+	}
+	return models
+}
+
+// consensus 把同一个建议请求并行发给多个模型，合并去重它们给出的命令，
+// 并记录每条命令由哪些模型提出。只要有一个模型回答成功就不返回错误
+func (c *Client) consensus(ctx context.Context, models []config.ModelConfig, req chatRequest) (SuggestResponse, error) {
+	// 多个模型的说明文字无法交错显示，共识模式不流式输出
+	req.onChunk = nil
+
+	answers := make([]ModelAnswer, len(models))
+	var wg sync.WaitGroup
+	for i, modelConfig := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 每个模型独立回答，不走回退链，否则无法确定是谁提出了命令
+			response, err := c.cached(modelConfig, req, func() (Response, error) {
+				return c.send(ctx, modelConfig, req)
+			})
+			answer := ModelAnswer{SuggestResponse: SuggestResponse{Response: response}, Err: err}
+			if err == nil {
+				answer.Suggestion, answer.Parsed = ParseSuggestion(response.Text)
+			}
+			answers[i] = answer
+		}()
+	}
+	wg.Wait()
+
+	return mergeAnswers(answers)
+}
+
+// mergeAnswers 合并各模型的建议：相同的命令只保留一条，被更多模型提出的命令排在前面。
+// 模型以 provider/model 标识，不同提供商的同名模型分别计票
+func mergeAnswers(answers []ModelAnswer) (SuggestResponse, error) {
+	merged := SuggestResponse{
+		Response: Response{Provider: "consensus", Structured: true, Cached: true, Priced: true},
+		Answers:  answers,
+	}
+
+	var models []string
+	var errs []error
+	index := make(map[string]int)
+	for _, answer := range answers {
+		voter := answer.Provider + "/" + answer.Model
+		if answer.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", voter, answer.Err))
+			continue
+		}
+
+		models = append(models, voter)
+		merged.Usage = merged.Usage.Add(answer.Usage)
+		merged.Cost += answer.Cost
+		merged.Priced = merged.Priced && answer.Priced
+		merged.Cached = merged.Cached && answer.Cached
+		if !answer.Parsed {
+			continue
+		}
+
+		if merged.Suggestion.Message == "" {
+			merged.Suggestion.Message = answer.Suggestion.Message
+		}
+		for _, cmd := range answer.Suggestion.Commands {
+			key := normalizeCommand(cmd.Command)
+			i, seen := index[key]
+			if !seen {
+				i = len(merged.Suggestion.Commands)
+				index[key] = i
+				merged.Suggestion.Commands = append(merged.Suggestion.Commands, SuggestedCommand{
+					Command:     cmd.Command,
+					Description: cmd.Description,
+				})
+			}
+			existing := &merged.Suggestion.Commands[i]
+			if existing.Description == "" {
+				existing.Description = cmd.Description
+			}
+			if !slices.Contains(existing.ProposedBy, voter) {
+				existing.ProposedBy = append(existing.ProposedBy, voter)
+			}
+		}
+	}
+
+	if len(models) == 0 {
+		return merged, fmt.Errorf("all consensus models failed: %w", errors.Join(errs...))
+	}
+
+	sort.SliceStable(merged.Suggestion.Commands, func(i, j int) bool {
+		return len(merged.Suggestion.Commands[i].ProposedBy) > len(merged.Suggestion.Commands[j].ProposedBy)
+	})
+	merged.Model = strings.Join(models, ", ")
+	merged.Parsed = len(merged.Suggestion.Commands) > 0
+
+	if merged.Parsed {
+		// 会话历史中记录合并后的建议，后续追问和重新生成都基于它
+		text, _ := json.Marshal(merged.Suggestion)
+		merged.Text = string(text)
+	} else {
+		merged.Text = firstAnswerText(answers)
+	}
+	return merged, nil
+}
+
+// normalizeCommand 忽略多余的空白，使 "ls  -la" 与 "ls -la" 视为同一条命令
+func normalizeCommand(command string) string {
+	return strings.Join(strings.Fields(command), " ")
+}
+
+func firstAnswerText(answers []ModelAnswer) string {
+	for _, answer := range answers {
+		if answer.Err == nil && answer.Text != "" {
+			return answer.Text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package ai
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestMergeAnswers 检查合并后的命令按提出它的模型数排序，不同提供商的同名模型分别计票
+func TestMergeAnswers(t *testing.T) {
+	answer := func(provider, model string, commands ...string) ModelAnswer {
+		a := ModelAnswer{SuggestResponse: SuggestResponse{
+			Response: Response{Provider: provider, Model: model, Priced: true},
+			Parsed:   true,
+		}}
+		a.Suggestion.Message = model + " says"
+		for _, command := range commands {
+			a.Suggestion.Commands = append(a.Suggestion.Commands, SuggestedCommand{Command: command})
+		}
+		return a
+	}
+	failed := answer("anthropic", "claude-sonnet-4-5")
+	failed.Parsed = false
+	failed.Err = errors.New("overloaded")
+
+	merged, err := mergeAnswers([]ModelAnswer{
+		answer("openai", "gpt-4o", "du -sh *", "ls -la"),
+		answer("azure", "gpt-4o", "ls  -la", "find . -size +100M"),
+		answer("openrouter", "gpt-4o", "find . -size +100M", "ls -la"),
+		failed,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		command    string
+		proposedBy []string
+	}{
+		{"ls -la", []string{"openai/gpt-4o", "azure/gpt-4o", "openrouter/gpt-4o"}},
+		{"find . -size +100M", []string{"azure/gpt-4o", "openrouter/gpt-4o"}},
+		{"du -sh *", []string{"openai/gpt-4o"}},
+	}
+	if len(merged.Suggestion.Commands) != len(want) {
+		t.Fatalf("merged commands = %+v, want %d commands", merged.Suggestion.Commands, len(want))
+	}
+	for i, w := range want {
+		got := merged.Suggestion.Commands[i]
+		if got.Command != w.command || !slices.Equal(got.ProposedBy, w.proposedBy) {
+			t.Errorf("command %d = %q proposed by %v, want %q proposed by %v", i, got.Command, got.ProposedBy, w.command, w.proposedBy)
+		}
+	}
+	if merged.Model != "openai/gpt-4o, azure/gpt-4o, openrouter/gpt-4o" {
+		t.Errorf("Model = %q", merged.Model)
+	}
+	if merged.Suggestion.Message != "gpt-4o says" || !merged.Parsed {
+		t.Errorf("Message = %q, Parsed = %v", merged.Suggestion.Message, merged.Parsed)
+	}
+
+	// 所有模型都失败时返回错误，错误中带有模型标识
+	_, err = mergeAnswers([]ModelAnswer{failed})
+	if err == nil || !strings.Contains(err.Error(), "anthropic/claude-sonnet-4-5: overloaded") {
+		t.Errorf("err = %v, want the failure of anthropic/claude-sonnet-4-5", err)
+	}
+}
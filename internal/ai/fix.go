@@ -0,0 +1,41 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// CommandResult 是 shell 中执行过的一条命令及其结果
+type CommandResult struct {
+	Command  string
+	Cwd      string
+	ExitCode int
+	Output   string // 输出的末尾部分，已去掉终端控制序列
+}
+
+// Fix 请求修正上一条命令，返回的建议与 Suggest 相同，可以直接在选择器中选用
+func (c *Client) Fix(ctx context.Context, result CommandResult, onMessage StreamHandler) (SuggestResponse, error) {
+	return c.suggest(ctx, c.history, fixPrompt(result), onMessage, false)
+}
+
+// fixPrompt 把命令、退出码和输出整理为请求修正的问题
+func fixPrompt(result CommandResult) string {
+	var b strings.Builder
+	if result.ExitCode != 0 {
+		fmt.Fprintf(&b, "This command failed with exit code %d. ", result.ExitCode)
+	} else {
+		b.WriteString("This command did not do what I wanted. ")
+	}
+	b.WriteString("Suggest corrected command(s) that do what I most likely intended, and say briefly what was wrong.\n\n")
+	fmt.Fprintf(&b, "Command: %s\n", result.Command)
+	if result.Cwd != "" {
+		fmt.Fprintf(&b, "Working directory: %s\n", result.Cwd)
+	}
+	if result.Output != "" {
+		fmt.Fprintf(&b, "Output (last lines):\n%s\n", result.Output)
+	} else {
+		b.WriteString("The command printed no output.\n")
+	}
+	return b.String()
+}
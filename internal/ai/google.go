@@ -20,10 +20,18 @@ type GoogleProvider struct {
 }
 
 type GoogleRequest struct {
-	Contents []GoogleContent `json:"contents"`
+	SystemInstruction *GoogleContent          `json:"systemInstruction,omitempty"`
+	Contents          []GoogleContent         `json:"contents"`
+	GenerationConfig  *GoogleGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type GoogleGenerationConfig struct {
+	ResponseMimeType string         `json:"responseMimeType,omitempty"`
+	ResponseSchema   map[string]any `json:"responseSchema,omitempty"`
 }
 
 type GoogleContent struct {
+	Role  string       `json:"role,omitempty"`
 	Parts []GooglePart `json:"parts"`
 }
 
@@ -32,8 +40,14 @@ type GooglePart struct {
 }
 
 type GoogleResponse struct {
-	Candidates []GoogleCandidate `json:"candidates"`
-	Error      *GoogleError      `json:"error,omitempty"`
+	Candidates    []GoogleCandidate    `json:"candidates"`
+	UsageMetadata *GoogleUsageMetadata `json:"usageMetadata,omitempty"`
+	Error         *GoogleError         `json:"error,omitempty"`
+}
+
+type GoogleUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
 }
 
 type GoogleCandidate struct {
@@ -58,44 +72,57 @@ type GoogleModelInfo struct {
 	SupportedGeneration []string `json:"supportedGenerationMethods"`
 }
 
+func init() {
+	Register(ProviderSpec{
+		Name: "google",
+		Factory: func(cfg config.ModelConfig) (Provider, error) {
+			return NewGoogleProvider(cfg)
+		},
+		Schema: config.ProviderSchema{
+			Key:            "gemini",
+			Priority:       20,
+			APIKeyEnv:      "GOOGLE_API_KEY",
+			BaseURLEnv:     "GOOGLE_BASE_URL",
+			DefaultBaseURL: "https://generativelanguage.googleapis.com",
+			ModelEnv:       "GOOGLE_MODEL",
+			DefaultModel:   "gemini-pro",
+		},
+		Capabilities: Capabilities{Streaming: true, ModelDiscovery: true, StructuredOutput: true},
+	})
+}
+
 func NewGoogleProvider(cfg config.ModelConfig) (*GoogleProvider, error) {
 	return &GoogleProvider{
 		apiKey:  cfg.APIKey,
 		baseURL: cfg.BaseURL,
 		model:   cfg.Model,
-		client:  &http.Client{},
+		client:  httpClient(),
 	}, nil
 }
 
-func (p *GoogleProvider) Query(ctx context.Context, prompt string) (string, error) {
-	requestBody := GoogleRequest{
-		Contents: []GoogleContent{
-			{
-				Parts: []GooglePart{
-					{
-						Text: prompt,
-					},
-				},
-			},
-		},
-	}
+func (p *GoogleProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	return p.chat(ctx, messages, nil)
+}
 
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
+func (p *GoogleProvider) ChatStream(ctx context.Context, messages []Message, onChunk StreamHandler) (string, error) {
+	return p.chatStream(ctx, messages, nil, onChunk)
+}
 
-	url := fmt.Sprintf("%s/v1beta/models/%s:generateContent?key=%s", p.baseURL, p.model, p.apiKey)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+// ChatStructured 使用 responseSchema 让 Gemini 直接输出符合 schema 的 JSON
+func (p *GoogleProvider) ChatStructured(ctx context.Context, messages []Message, schema OutputSchema, onChunk StreamHandler) (string, error) {
+	if onChunk != nil {
+		return p.chatStream(ctx, messages, &schema, onChunk)
 	}
+	return p.chat(ctx, messages, &schema)
+}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := p.client.Do(req)
+func (p *GoogleProvider) chat(ctx context.Context, messages []Message, schema *OutputSchema) (string, error) {
+	url := fmt.Sprintf("%s/v1beta/models/%s:generateContent?key=%s", p.baseURL, p.model, p.apiKey)
+	resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+		return p.newRequest(ctx, url, messages, schema)
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -104,10 +131,6 @@ func (p *GoogleProvider) Query(ctx context.Context, prompt string) (string, erro
 		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var response GoogleResponse
 	if err := json.Unmarshal(body, &response); err != nil {
 		return "", fmt.Errorf("failed to unmarshal response: %w", err)
@@ -117,23 +140,180 @@ func (p *GoogleProvider) Query(ctx context.Context, prompt string) (string, erro
 		return "", fmt.Errorf("API error: %s", response.Error.Message)
 	}
 
+	if response.UsageMetadata != nil {
+		ReportUsage(ctx, response.UsageMetadata.PromptTokenCount, response.UsageMetadata.CandidatesTokenCount)
+	}
+
 	if len(response.Candidates) == 0 || len(response.Candidates[0].Content.Parts) == 0 {
 		return "", nil
 	}
 
+	if schema != nil {
+		// JSON 输出可能被拆分到多个 part 中
+		var text strings.Builder
+		for _, part := range response.Candidates[0].Content.Parts {
+			text.WriteString(part.Text)
+		}
+		return text.String(), nil
+	}
+
 	return response.Candidates[0].Content.Parts[0].Text, nil
 }
 
-func (p *GoogleProvider) GetAvailableModels() ([]string, error) {
-	url := fmt.Sprintf("%s/v1beta/models?key=%s", p.baseURL, p.apiKey)
-	req, err := http.NewRequest("GET", url, nil)
+func (p *GoogleProvider) chatStream(ctx context.Context, messages []Message, schema *OutputSchema, onChunk StreamHandler) (string, error) {
+	// alt=sse 让 Gemini 以 SSE 形式返回每个增量 GenerateContentResponse
+	url := fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent?alt=sse&key=%s", p.baseURL, p.model, p.apiKey)
+	resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+		req, err := p.newRequest(ctx, url, messages, schema)
+		if err == nil {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+		return req, err
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	err = readSSE(resp.Body, func(event, data string) error {
+		var response GoogleResponse
+		if err := json.Unmarshal([]byte(data), &response); err != nil {
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+
+		if response.Error != nil {
+			return fmt.Errorf("API error: %s", response.Error.Message)
+		}
+
+		// 每个分片都带有截至当前的累计用量
+		if response.UsageMetadata != nil {
+			ReportUsage(ctx, response.UsageMetadata.PromptTokenCount, response.UsageMetadata.CandidatesTokenCount)
+		}
+
+		if len(response.Candidates) == 0 {
+			return nil
+		}
+		for _, part := range response.Candidates[0].Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			text.WriteString(part.Text)
+			if onChunk != nil {
+				onChunk(part.Text)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return text.String(), err
+	}
+
+	return text.String(), nil
+}
+
+func (p *GoogleProvider) newRequest(ctx context.Context, url string, messages []Message, schema *OutputSchema) (*http.Request, error) {
+	system, conversation := splitSystemMessages(messages)
+
+	var requestBody GoogleRequest
+	if system != "" {
+		requestBody.SystemInstruction = &GoogleContent{
+			Parts: []GooglePart{
+				{
+					Text: system,
+				},
+			},
+		}
+	}
+	for _, msg := range conversation {
+		// Gemini 使用 "model" 表示助手角色
+		role := msg.Role
+		if role == RoleAssistant {
+			role = "model"
+		}
+		requestBody.Contents = append(requestBody.Contents, GoogleContent{
+			Role: role,
+			Parts: []GooglePart{
+				{
+					Text: msg.Content,
+				},
+			},
+		})
+	}
+
+	if schema != nil {
+		requestBody.GenerationConfig = &GoogleGenerationConfig{
+			ResponseMimeType: "application/json",
+			ResponseSchema:   toGoogleSchema(schema.Schema),
+		}
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := p.client.Do(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+// toGoogleSchema 将标准 JSON Schema 转换为 Gemini 支持的 OpenAPI 子集：
+// 类型名使用大写，不支持 additionalProperties
+func toGoogleSchema(schema map[string]any) map[string]any {
+	converted := make(map[string]any, len(schema))
+	for key, value := range schema {
+		switch key {
+		case "additionalProperties":
+			continue
+		case "type":
+			if t, ok := value.(string); ok {
+				value = strings.ToUpper(t)
+			}
+		case "items":
+			if items, ok := value.(map[string]any); ok {
+				value = toGoogleSchema(items)
+			}
+		case "properties":
+			if props, ok := value.(map[string]any); ok {
+				convertedProps := make(map[string]any, len(props))
+				for name, prop := range props {
+					if propSchema, ok := prop.(map[string]any); ok {
+						convertedProps[name] = toGoogleSchema(propSchema)
+					} else {
+						convertedProps[name] = prop
+					}
+				}
+				value = convertedProps
+			}
+		}
+		converted[key] = value
+	}
+	// Gemini 默认按字母顺序输出属性，这里按 required 的顺序输出，保证说明文字先于命令流式返回
+	if required, ok := schema["required"].([]string); ok {
+		if _, hasProps := schema["properties"]; hasProps {
+			converted["propertyOrdering"] = required
+		}
+	}
+	return converted
+}
+
+func (p *GoogleProvider) GetAvailableModels(ctx context.Context) ([]string, error) {
+	url := fmt.Sprintf("%s/v1beta/models?key=%s", p.baseURL, p.apiKey)
+	resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		return req, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -142,10 +322,6 @@ func (p *GoogleProvider) GetAvailableModels() ([]string, error) {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var response GoogleModelsResponse
 	if err := json.Unmarshal(body, &response); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
@@ -0,0 +1,146 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/xian/xsh/internal/kb"
+)
+
+const (
+	// maxGroundingTools 是一次请求最多附带文档的程序数量
+	maxGroundingTools = 3
+	// groundingExcerptBytes 是每个程序附带的文档摘录长度上限
+	groundingExcerptBytes = 2000
+)
+
+// toolWordPattern 匹配问题中可能是程序名的词
+var toolWordPattern = regexp.MustCompile("[A-Za-z][A-Za-z0-9_.+-]*")
+
+// commonWords 是同时也是程序名的常见英文单词，出现在问题中时通常不是指该程序
+var commonWords = map[string]bool{
+	"which": true, "file": true, "time": true, "test": true, "yes": true, "more": true, "less": true,
+	"look": true, "last": true, "users": true, "write": true, "who": true, "true": true, "false": true,
+	"from": true, "join": true, "split": true, "dir": true, "info": true, "id": true, "link": true,
+	"top": true, "install": true, "open": true, "script": true, "size": true, "strings": true,
+	"expand": true, "fold": true, "paste": true, "whatis": true, "see": true, "as": true, "do": true,
+}
+
+// mentionedTools 返回问题中提到的、本机已安装的程序
+func mentionedTools(prompt string) []string {
+	var tools []string
+	seen := make(map[string]bool)
+	for _, word := range toolWordPattern.FindAllString(prompt, -1) {
+		word = strings.TrimRight(word, ".")
+		if len(word) < 2 || seen[word] || commonWords[strings.ToLower(word)] {
+			continue
+		}
+		seen[word] = true
+		if _, err := exec.LookPath(word); err != nil {
+			continue
+		}
+		tools = append(tools, word)
+		if len(tools) == maxGroundingTools {
+			break
+		}
+	}
+	return tools
+}
+
+// groundingPrompt 为 programs 生成附加在系统提示后的本机文档摘录，没有可用文档时返回空字符串
+func groundingPrompt(query string, docs []*kb.Doc) string {
+	var b strings.Builder
+	for _, doc := range docs {
+		excerpt := doc.Excerpt(query, groundingExcerptBytes)
+		if excerpt == "" {
+			continue
+		}
+		source := "man page"
+		if doc.Source == "help" {
+			source = "--help output"
+		}
+		fmt.Fprintf(&b, "\n--- %s (%s) ---\n%s\n", doc.Program, source, excerpt)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "Documentation for tools installed on this machine follows. The installed versions may differ from what you remember: " +
+		"only use options that are documented here.\n" + b.String()
+}
+
+// grounding 查找问题中提到的程序的本机文档，未启用时返回空字符串
+func (c *Client) grounding(ctx context.Context, prompt string) string {
+	if !c.config.Grounding.Enabled {
+		return ""
+	}
+	var docs []*kb.Doc
+	for _, tool := range mentionedTools(prompt) {
+		if doc, ok := kb.LookupDoc(ctx, tool); ok {
+			docs = append(docs, doc)
+		}
+	}
+	return groundingPrompt(prompt, docs)
+}
+
+// checkFlags 用本机文档核对每条候选命令的选项，把找不到的选项记录在 Undocumented 中。
+// 有任何命令使用了未记载的选项时返回 true
+func (c *Client) checkFlags(ctx context.Context, suggestion *Suggestion) bool {
+	if !c.config.Grounding.Enabled {
+		return false
+	}
+	found := false
+	for i := range suggestion.Commands {
+		suggestion.Commands[i].Undocumented = kb.UndocumentedFlags(ctx, suggestion.Commands[i].Command)
+		if len(suggestion.Commands[i].Undocumented) > 0 {
+			found = true
+		}
+	}
+	return found
+}
+
+// reask 在建议中的命令使用了本机文档没有记载的选项时，附上这些命令的文档和问题说明重新请求一次。
+// 重新请求失败或仍无法解析时保留原来的建议
+func (c *Client) reask(ctx context.Context, req chatRequest, prompt string, first SuggestResponse) SuggestResponse {
+	var (
+		docs  []*kb.Doc
+		notes []string
+		seen  = make(map[string]bool)
+	)
+	for _, cmd := range first.Suggestion.Commands {
+		if len(cmd.Undocumented) == 0 {
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("- `%s`: %s", cmd.Command, strings.Join(cmd.Undocumented, ", ")))
+		for _, invocation := range kb.ParseInvocations(cmd.Command) {
+			doc, ok := kb.InvocationDoc(ctx, invocation)
+			if ok && !seen[doc.Program] && len(docs) < maxGroundingTools {
+				seen[doc.Program] = true
+				docs = append(docs, doc)
+			}
+		}
+	}
+
+	req.grounding = groundingPrompt(prompt, docs) +
+		"\nA previous answer to this request used options that are not documented for the tools installed here:\n" +
+		strings.Join(notes, "\n") + "\nSuggest the commands again using only documented options."
+	// 说明文字已经随第一次回答显示过了
+	req.onChunk = nil
+
+	response, err := c.do(ctx, req)
+	if err != nil {
+		return first
+	}
+	suggestion, ok := ParseSuggestion(response.Text)
+	if !ok {
+		return first
+	}
+	c.checkFlags(ctx, &suggestion)
+
+	response.Usage = response.Usage.Add(first.Usage)
+	response.Cost += first.Cost
+	response.Priced = response.Priced || first.Priced
+	return SuggestResponse{Response: response, Suggestion: suggestion, Parsed: true, Reasked: true}
+}
@@ -0,0 +1,133 @@
+package ai
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xian/xsh/internal/config"
+)
+
+// hedgeModels 解析 XSH_HEDGE 中已配置且与主模型不同的备用模型
+func (c *Client) hedgeModels(primary config.ModelConfig) []config.ModelConfig {
+	if c.config.Hedge.Delay <= 0 {
+		return nil
+	}
+
+	var models []config.ModelConfig
+	for _, ref := range c.config.Hedge.Backups {
+		modelConfig, exists := c.config.ResolveModel(ref.Name, ref.Model)
+		if !exists {
+			continue
+		}
+		same := func(m config.ModelConfig) bool {
+			return m.Provider == modelConfig.Provider && m.Model == modelConfig.Model
+		}
+		if same(primary) || slices.ContainsFunc(models, same) {
+			continue
+		}
+		models = append(models, modelConfig)
+	}
+	return models
+}
+
+// hedge 先向主模型发送请求，如果超过 Hedge.Delay 仍没有开始收到回复，就依次启动备用模型的请求。
+// 采用最先到达的有效回复并取消其余请求；全部无效时返回主模型的结果
+func (c *Client) hedge(ctx context.Context, primary config.ModelConfig, backups []config.ModelConfig, req chatRequest) (Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // 取消仍在进行的落选请求
+
+	type result struct {
+		attempt  int
+		response Response
+		err      error
+	}
+	results := make(chan result, 1+len(backups))
+
+	// 只有最先开始流式输出的请求会被显示，避免几个模型的文字交错
+	var mu sync.Mutex
+	streamer := -1
+	streaming := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return streamer != -1
+	}
+	attemptRequest := func(attempt int) chatRequest {
+		attemptReq := req
+		if onChunk := req.onChunk; onChunk != nil {
+			attemptReq.onChunk = func(chunk string) {
+				mu.Lock()
+				defer mu.Unlock()
+				if streamer == -1 {
+					streamer = attempt
+				}
+				if streamer == attempt {
+					onChunk(chunk)
+				}
+			}
+		}
+		return attemptReq
+	}
+
+	launched := 0
+	launch := func() {
+		attempt := launched
+		launched++
+		go func() {
+			var response Response
+			var err error
+			if attempt == 0 {
+				response, err = c.tryModels(ctx, primary, attemptRequest(attempt))
+			} else {
+				response, err = c.send(ctx, backups[attempt-1], attemptRequest(attempt))
+				response.Hedged = true
+			}
+			results <- result{attempt: attempt, response: response, err: err}
+		}()
+	}
+
+	launch()
+	pending := 1
+	timer := time.NewTimer(c.config.Hedge.Delay)
+	defer timer.Stop()
+
+	var primaryResult *result
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			// 已经开始流式输出说明回复正在到达，不再启动备用请求
+			if launched <= len(backups) && !streaming() {
+				launch()
+				pending++
+				timer.Reset(c.config.Hedge.Delay)
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil && validResponse(req, r.response) {
+				return r.response, nil
+			}
+			if r.attempt == 0 {
+				primaryResult = &r
+			}
+			// 所有请求都已失败时立即启动下一个备用请求，不必等待
+			if pending == 0 && launched <= len(backups) && ctx.Err() == nil {
+				launch()
+				pending++
+				timer.Reset(c.config.Hedge.Delay)
+			}
+		}
+	}
+
+	return primaryResult.response, primaryResult.err
+}
+
+// validResponse 判断一个回复是否可以直接采用：建议请求需要解析出命令，其他请求需要非空
+func validResponse(req chatRequest, response Response) bool {
+	if req.suggest {
+		_, ok := ParseSuggestion(response.Text)
+		return ok
+	}
+	return strings.TrimSpace(response.Text) != ""
+}
@@ -0,0 +1,137 @@
+package ai
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/xian/xsh/internal/config"
+)
+
+// sharedClient 是所有提供商共用的 HTTP 客户端，由 ConfigureTransport 按配置替换
+var sharedClient atomic.Pointer[http.Client]
+
+func init() {
+	sharedClient.Store(&http.Client{})
+}
+
+// httpClient 返回提供商发送请求时使用的 HTTP 客户端
+func httpClient() *http.Client {
+	return sharedClient.Load()
+}
+
+// ConfigureTransport 按配置设置所有提供商共用的代理和 TLS 参数，
+// 只影响之后创建的提供商
+func ConfigureTransport(cfg config.TransportConfig) error {
+	client, err := NewHTTPClient(cfg)
+	if err != nil {
+		return err
+	}
+	sharedClient.Store(client)
+	return nil
+}
+
+// NewHTTPClient 创建使用指定代理、根证书和客户端证书的 HTTP 客户端。
+// 请求的超时由调用方的 context 控制，客户端本身不设置总超时，以免截断流式响应
+func NewHTTPClient(cfg config.TransportConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	proxy, err := proxyFunc(cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// proxyFunc 解析代理设置：为空时使用 HTTPS_PROXY / HTTP_PROXY / NO_PROXY，
+// "direct" 表示不使用代理，否则是 http、https、socks5 或 socks5h 代理地址。
+// 访问本机地址（如本地 Ollama）时总是直连
+func proxyFunc(value string) (func(*http.Request) (*url.URL, error), error) {
+	switch strings.ToLower(value) {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case "direct", "none":
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(value)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", value)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (use http, https, socks5 or socks5h)", proxyURL.Scheme)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if isLoopback(req.URL.Hostname()) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// newTLSConfig 在系统根证书之外追加 CABundle，并加载 mTLS 客户端证书；
+// 两者都未配置时返回 nil，使用默认设置
+func newTLSConfig(cfg config.TransportConfig) (*tls.Config, error) {
+	if cfg.CABundle == "" && cfg.ClientCert == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CABundle != "" {
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCert != "" {
+		// 私钥未单独配置时，证书文件中应同时包含证书和私钥
+		keyFile := cfg.ClientKey
+		if keyFile == "" {
+			keyFile = cfg.ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,215 @@
+package ai
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xian/xsh/internal/config"
+)
+
+// TestHTTPClientCABundle 检查 CABundle 中的根证书被信任
+func TestHTTPClientCABundle(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	// 第一次请求预期握手失败，不输出服务器端的日志
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	// 未配置时服务器的自签名证书不受信任
+	client, err := NewHTTPClient(config.TransportConfig{Proxy: "direct"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := client.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("self-signed certificate trusted without a CA bundle")
+	}
+
+	bundle := writePEM(t, "ca.pem", pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	client, err = NewHTTPClient(config.TransportConfig{Proxy: "direct", CABundle: bundle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := get(t, client, server.URL); body != "ok" {
+		t.Errorf("body = %q, want %q", body, "ok")
+	}
+}
+
+// TestHTTPClientCertificate 检查 mTLS 握手时出示了 ClientCert 中的客户端证书
+func TestHTTPClientCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "xsh-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	bundle := writePEM(t, "ca.pem", pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	// 没有客户端证书时服务器拒绝握手
+	client, err := NewHTTPClient(config.TransportConfig{Proxy: "direct", CABundle: bundle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := client.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("server accepted a connection without a client certificate")
+	}
+
+	// 证书和私钥在同一个文件中
+	combined := writePEM(t, "client.pem",
+		pem.Block{Type: "CERTIFICATE", Bytes: der},
+		pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	client, err = NewHTTPClient(config.TransportConfig{Proxy: "direct", CABundle: bundle, ClientCert: combined})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := get(t, client, server.URL); body != "xsh-client" {
+		t.Errorf("server saw client %q, want %q", body, "xsh-client")
+	}
+
+	// 证书和私钥分开保存
+	certFile := writePEM(t, "client.crt", pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyFile := writePEM(t, "client.key", pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	client, err = NewHTTPClient(config.TransportConfig{Proxy: "direct", CABundle: bundle, ClientCert: certFile, ClientKey: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := get(t, client, server.URL); body != "xsh-client" {
+		t.Errorf("server saw client %q, want %q", body, "xsh-client")
+	}
+}
+
+// TestHTTPClientProxy 检查请求经过 Proxy 指定的代理，访问本机地址时直连
+func TestHTTPClientProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			// HTTPS 请求先通过 CONNECT 建立隧道，这里只记录目标，不真正转发
+			proxied = append(proxied, "CONNECT "+r.Host)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		proxied = append(proxied, r.URL.String())
+		io.WriteString(w, "via proxy")
+	}))
+	defer proxy.Close()
+
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "direct")
+	}))
+	defer local.Close()
+
+	// 代理环境变量不应生效
+	t.Setenv("HTTP_PROXY", "http://127.0.0.1:1")
+	t.Setenv("HTTPS_PROXY", "http://127.0.0.1:1")
+
+	client, err := NewHTTPClient(config.TransportConfig{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body := get(t, client, "http://api.example.com/v1/models"); body != "via proxy" {
+		t.Errorf("body = %q, want %q", body, "via proxy")
+	}
+	if len(proxied) != 1 || proxied[0] != "http://api.example.com/v1/models" {
+		t.Errorf("proxy received %v, want [http://api.example.com/v1/models]", proxied)
+	}
+
+	if resp, err := client.Get("https://api.example.com/v1/models"); err == nil {
+		resp.Body.Close()
+		t.Error("HTTPS request succeeded although the proxy refused the tunnel")
+	}
+	if len(proxied) != 2 || proxied[1] != "CONNECT api.example.com:443" {
+		t.Errorf("proxy received %v, want a CONNECT to api.example.com:443", proxied)
+	}
+
+	if body := get(t, client, local.URL); body != "direct" {
+		t.Errorf("loopback request body = %q, want %q", body, "direct")
+	}
+	if len(proxied) != 2 {
+		t.Errorf("loopback request went through the proxy: %v", proxied)
+	}
+}
+
+// TestHTTPClientInvalidProxy 检查无法使用的代理地址在创建客户端时报错
+func TestHTTPClientInvalidProxy(t *testing.T) {
+	for _, value := range []string{"ftp://proxy:21", "proxy:8080", "://"} {
+		if _, err := NewHTTPClient(config.TransportConfig{Proxy: value}); err == nil {
+			t.Errorf("NewHTTPClient(Proxy: %q) succeeded, want error", value)
+		}
+	}
+}
+
+// writePEM 把 blocks 写入临时目录下的 name，返回文件路径
+func writePEM(t *testing.T, name string, blocks ...pem.Block) string {
+	t.Helper()
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, pem.EncodeToMemory(&block)...)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// get 发送 GET 请求并返回响应正文
+func get(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
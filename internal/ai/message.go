@@ -0,0 +1,30 @@
+package ai
+
+import "strings"
+
+// 对话消息的角色
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message 是一条对话消息，各提供商将其映射为自己的请求格式
+type Message struct {
+	Role    string
+	Content string
+}
+
+// splitSystemMessages 将 system 消息从对话中分离出来，
+// 供使用独立系统提示字段的请求格式（Anthropic system、Gemini systemInstruction）使用
+func splitSystemMessages(messages []Message) (system string, conversation []Message) {
+	var parts []string
+	for _, msg := range messages {
+		if msg.Role == RoleSystem {
+			parts = append(parts, msg.Content)
+			continue
+		}
+		conversation = append(conversation, msg)
+	}
+	return strings.Join(parts, "\n\n"), conversation
+}
@@ -0,0 +1,142 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/xian/xsh/internal/config"
+	"github.com/xian/xsh/internal/kb"
+)
+
+// offlineModel 是离线提供商唯一的"模型"名称
+const offlineModel = "bm25"
+
+// offlineResults 是离线检索返回的候选命令数量
+const offlineResults = 5
+
+// OfflineProvider 不访问网络，从本地的 tldr 页面和手册页中检索命令示例，
+// 用于没有网络或没有 API 密钥的环境
+type OfflineProvider struct {
+	sources kb.Sources
+}
+
+func init() {
+	Register(ProviderSpec{
+		Name: "offline",
+		Factory: func(cfg config.ModelConfig) (Provider, error) {
+			return NewOfflineProvider(cfg)
+		},
+		Schema: config.ProviderSchema{
+			Key:          "offline",
+			Priority:     100,
+			DefaultModel: offlineModel,
+			DisableEnv:   "XSH_OFFLINE",
+			Options: []config.ProviderOption{
+				{Name: "tldr-path", Env: "XSH_TLDR_PATH"},
+			},
+		},
+		Capabilities: Capabilities{Local: true, StructuredOutput: true},
+	})
+}
+
+func NewOfflineProvider(cfg config.ModelConfig) (*OfflineProvider, error) {
+	sources := kb.Sources{
+		TLDRDirs: searchPath(cfg.Options["tldr-path"], kb.DefaultTLDRDirs()),
+		ManDirs:  kb.ManDirs(),
+	}
+	return &OfflineProvider{sources: sources}, nil
+}
+
+// searchPath 解析以冒号分隔的目录列表，与 MANPATH 一样，空的一项表示默认目录
+func searchPath(value string, defaults []string) []string {
+	if value == "" {
+		return defaults
+	}
+	var dirs []string
+	for _, dir := range filepath.SplitList(value) {
+		if dir == "" {
+			dirs = append(dirs, defaults...)
+		} else {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func (p *OfflineProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	suggestion, err := p.suggest(messages)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(userMsgPrefix + "\n" + suggestion.Message + "\n\n" + shellCmdPrefix + "\n")
+	for _, cmd := range suggestion.Commands {
+		b.WriteString(cmd.Command + "\n")
+	}
+	return b.String(), nil
+}
+
+func (p *OfflineProvider) ChatStream(ctx context.Context, messages []Message, onChunk StreamHandler) (string, error) {
+	text, err := p.Chat(ctx, messages)
+	if err == nil {
+		onChunk(text)
+	}
+	return text, err
+}
+
+// ChatStructured 以结构化格式返回检索结果，使每条候选命令都带有示例说明
+func (p *OfflineProvider) ChatStructured(ctx context.Context, messages []Message, schema OutputSchema, onChunk StreamHandler) (string, error) {
+	suggestion, err := p.suggest(messages)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(suggestion)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal suggestion: %w", err)
+	}
+	if onChunk != nil {
+		onChunk(string(data))
+	}
+	return string(data), nil
+}
+
+// suggest 用最后一条用户消息检索知识库
+func (p *OfflineProvider) suggest(messages []Message) (Suggestion, error) {
+	var query string
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == RoleUser {
+			query = messages[i].Content
+			break
+		}
+	}
+
+	index := kb.Load(p.sources)
+	results := index.Search(query, offlineResults)
+	if len(results) == 0 {
+		return Suggestion{}, fmt.Errorf("no offline match for %q in %d local command examples", query, index.Len())
+	}
+
+	suggestion := Suggestion{
+		Message: "Offline suggestions from the local command knowledge base (no AI model was used).",
+	}
+	for _, result := range results {
+		description := result.Description
+		if result.Source == "man" {
+			description += " (see man " + result.Program + ")"
+		}
+		suggestion.Commands = append(suggestion.Commands, SuggestedCommand{
+			Command:     result.Command,
+			Description: description,
+		})
+	}
+	return suggestion, nil
+}
+
+func (p *OfflineProvider) GetAvailableModels(ctx context.Context) ([]string, error) {
+	return []string{offlineModel}, nil
+}
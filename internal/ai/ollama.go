@@ -0,0 +1,211 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/xian/xsh/internal/config"
+)
+
+// OllamaProvider 访问本地 Ollama 风格的 HTTP 服务，不需要 API 密钥
+type OllamaProvider struct {
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+type OllamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []OllamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+}
+
+type OllamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type OllamaResponse struct {
+	Message         OllamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"` // 仅在 done 时返回
+	EvalCount       int           `json:"eval_count,omitempty"`
+	Error           string        `json:"error,omitempty"`
+}
+
+type OllamaTagsResponse struct {
+	Models []OllamaModel `json:"models"`
+}
+
+type OllamaModel struct {
+	Name       string `json:"name"`
+	Model      string `json:"model"`
+	ModifiedAt string `json:"modified_at"`
+	Size       int64  `json:"size"`
+}
+
+func init() {
+	Register(ProviderSpec{
+		Name: "ollama",
+		Factory: func(cfg config.ModelConfig) (Provider, error) {
+			return NewOllamaProvider(cfg)
+		},
+		Schema: config.ProviderSchema{
+			Key:              "ollama",
+			Priority:         40,
+			BaseURLEnv:       "OLLAMA_HOST",
+			DefaultBaseURL:   "http://localhost:11434",
+			ModelEnv:         "OLLAMA_MODEL",
+			DefaultModel:     "llama3.2",
+			EnableEnv:        []string{"OLLAMA_HOST", "OLLAMA_MODEL"},
+			NormalizeBaseURL: ollamaBaseURL,
+		},
+		Capabilities: Capabilities{Streaming: true, ModelDiscovery: true, Local: true},
+	})
+}
+
+func NewOllamaProvider(cfg config.ModelConfig) (*OllamaProvider, error) {
+	return &OllamaProvider{
+		baseURL: ollamaBaseURL(cfg.BaseURL),
+		model:   cfg.Model,
+		client:  httpClient(),
+	}, nil
+}
+
+// ollamaBaseURL 规范化 OLLAMA_HOST，允许省略协议（如 "127.0.0.1:11434"）
+func ollamaBaseURL(host string) string {
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+	return strings.TrimRight(host, "/")
+}
+
+func (p *OllamaProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+		return p.newRequest(ctx, messages, false)
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var response OllamaResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if response.Error != "" {
+		return "", fmt.Errorf("API error: %s", response.Error)
+	}
+
+	ReportUsage(ctx, response.PromptEvalCount, response.EvalCount)
+	return response.Message.Content, nil
+}
+
+func (p *OllamaProvider) ChatStream(ctx context.Context, messages []Message, onChunk StreamHandler) (string, error) {
+	resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+		return p.newRequest(ctx, messages, true)
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Ollama 的流式响应是每行一个 JSON 对象
+	var text strings.Builder
+	err = readJSONLines(resp.Body, func(line []byte) error {
+		var chunk OllamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+
+		if chunk.Error != "" {
+			return fmt.Errorf("API error: %s", chunk.Error)
+		}
+
+		if chunk.Done {
+			ReportUsage(ctx, chunk.PromptEvalCount, chunk.EvalCount)
+		}
+
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			if onChunk != nil {
+				onChunk(chunk.Message.Content)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return text.String(), err
+	}
+
+	return text.String(), nil
+}
+
+func (p *OllamaProvider) newRequest(ctx context.Context, messages []Message, stream bool) (*http.Request, error) {
+	requestBody := OllamaRequest{
+		Model:  p.model,
+		Stream: stream,
+	}
+	for _, msg := range messages {
+		requestBody.Messages = append(requestBody.Messages, OllamaMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/api/chat", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+func (p *OllamaProvider) GetAvailableModels(ctx context.Context) ([]string, error) {
+	resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/api/tags", nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var response OllamaTagsResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var models []string
+	for _, model := range response.Models {
+		models = append(models, model.Name)
+	}
+
+	return models, nil
+}
@@ -17,13 +17,36 @@ type OpenAIProvider struct {
 	baseURL string
 	model   string
 	client  *http.Client
+	// chatURL 和 authorize 决定请求发往哪里以及如何认证，兼容服务（如 Azure OpenAI）可以替换它们
+	chatURL   string
+	authorize func(req *http.Request)
 }
 
 type OpenAIRequest struct {
-	Model       string          `json:"model"`
-	Messages    []OpenAIMessage `json:"messages"`
-	MaxTokens   int             `json:"max_tokens"`
-	Temperature float64         `json:"temperature"`
+	Model          string                `json:"model"`
+	Messages       []OpenAIMessage       `json:"messages"`
+	MaxTokens      int                   `json:"max_tokens"`
+	Temperature    float64               `json:"temperature"`
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"`
+	Stream         bool                  `json:"stream,omitempty"`
+	StreamOptions  *OpenAIStreamOptions  `json:"stream_options,omitempty"`
+}
+
+// OpenAIStreamOptions 中的 include_usage 让流式响应在最后一个分片中返回 token 用量
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type OpenAIJSONSchema struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema"`
+	Strict      bool           `json:"strict"`
 }
 
 type OpenAIMessage struct {
@@ -33,13 +56,29 @@ type OpenAIMessage struct {
 
 type OpenAIResponse struct {
 	Choices []OpenAIChoice `json:"choices"`
+	Usage   *OpenAIUsage   `json:"usage,omitempty"`
 	Error   *OpenAIError   `json:"error,omitempty"`
 }
 
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
 type OpenAIChoice struct {
 	Message OpenAIMessage `json:"message"`
 }
 
+type OpenAIStreamChunk struct {
+	Choices []OpenAIStreamChoice `json:"choices"`
+	Usage   *OpenAIUsage         `json:"usage,omitempty"`
+	Error   *OpenAIError         `json:"error,omitempty"`
+}
+
+type OpenAIStreamChoice struct {
+	Delta OpenAIMessage `json:"delta"`
+}
+
 type OpenAIError struct {
 	Message string `json:"message"`
 	Type    string `json:"type"`
@@ -56,44 +95,74 @@ type OpenAIModel struct {
 	OwnedBy string `json:"owned_by"`
 }
 
+func init() {
+	Register(ProviderSpec{
+		Name: "openai",
+		Factory: func(cfg config.ModelConfig) (Provider, error) {
+			return NewOpenAIProvider(cfg)
+		},
+		Schema: config.ProviderSchema{
+			Key:            "openai",
+			Priority:       30,
+			APIKeyEnv:      "OPENAI_API_KEY",
+			BaseURLEnv:     "OPENAI_BASE_URL",
+			DefaultBaseURL: "https://api.openai.com/v1",
+			ModelEnv:       "OPENAI_MODEL",
+			DefaultModel:   "gpt-3.5-turbo",
+		},
+		Capabilities: Capabilities{
+			Streaming: true, ModelDiscovery: true, StructuredOutput: true,
+			StructuredModel: openAIStructuredModel,
+		},
+	})
+}
+
+// openAIStructuredModel 排除不支持 json_schema 响应格式的旧模型，这些模型收到该参数会返回 400
+func openAIStructuredModel(model string) bool {
+	switch {
+	case strings.HasPrefix(model, "gpt-3.5"), model == "gpt-4", strings.HasPrefix(model, "gpt-4-"),
+		model == "gpt-4o-2024-05-13":
+		return false
+	}
+	return true
+}
+
 func NewOpenAIProvider(cfg config.ModelConfig) (*OpenAIProvider, error) {
-	return &OpenAIProvider{
+	p := &OpenAIProvider{
 		apiKey:  cfg.APIKey,
 		baseURL: cfg.BaseURL,
 		model:   cfg.Model,
-		client:  &http.Client{},
-	}, nil
+		client:  httpClient(),
+		chatURL: cfg.BaseURL + "/chat/completions",
+	}
+	p.authorize = func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	return p, nil
 }
 
-func (p *OpenAIProvider) Query(ctx context.Context, prompt string) (string, error) {
-	requestBody := OpenAIRequest{
-		Model: p.model,
-		Messages: []OpenAIMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-		MaxTokens:   1000,
-		Temperature: 0.7,
-	}
+func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	return p.chat(ctx, messages, nil)
+}
 
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
+func (p *OpenAIProvider) ChatStream(ctx context.Context, messages []Message, onChunk StreamHandler) (string, error) {
+	return p.chatStream(ctx, messages, nil, onChunk)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+// ChatStructured 使用 response_format 的 json_schema 模式获得结构化输出
+func (p *OpenAIProvider) ChatStructured(ctx context.Context, messages []Message, schema OutputSchema, onChunk StreamHandler) (string, error) {
+	if onChunk != nil {
+		return p.chatStream(ctx, messages, &schema, onChunk)
 	}
+	return p.chat(ctx, messages, &schema)
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
-
-	resp, err := p.client.Do(req)
+func (p *OpenAIProvider) chat(ctx context.Context, messages []Message, schema *OutputSchema) (string, error) {
+	resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+		return p.newRequest(ctx, messages, false, schema)
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -102,10 +171,6 @@ func (p *OpenAIProvider) Query(ctx context.Context, prompt string) (string, erro
 		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var response OpenAIResponse
 	if err := json.Unmarshal(body, &response); err != nil {
 		return "", fmt.Errorf("failed to unmarshal response: %w", err)
@@ -115,6 +180,10 @@ func (p *OpenAIProvider) Query(ctx context.Context, prompt string) (string, erro
 		return "", fmt.Errorf("API error: %s", response.Error.Message)
 	}
 
+	if response.Usage != nil {
+		ReportUsage(ctx, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+	}
+
 	if len(response.Choices) == 0 {
 		return "", nil
 	}
@@ -122,17 +191,112 @@ func (p *OpenAIProvider) Query(ctx context.Context, prompt string) (string, erro
 	return response.Choices[0].Message.Content, nil
 }
 
-func (p *OpenAIProvider) GetAvailableModels() ([]string, error) {
-	req, err := http.NewRequest("GET", p.baseURL+"/models", nil)
+func (p *OpenAIProvider) chatStream(ctx context.Context, messages []Message, schema *OutputSchema, onChunk StreamHandler) (string, error) {
+	resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+		req, err := p.newRequest(ctx, messages, true, schema)
+		if err == nil {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+		return req, err
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	err = readSSE(resp.Body, func(event, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+
+		var chunk OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+
+		if chunk.Error != nil {
+			return fmt.Errorf("API error: %s", chunk.Error.Message)
+		}
+
+		if chunk.Usage != nil {
+			ReportUsage(ctx, chunk.Usage.PromptTokens, chunk.Usage.CompletionTokens)
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			text.WriteString(choice.Delta.Content)
+			if onChunk != nil {
+				onChunk(choice.Delta.Content)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return text.String(), err
+	}
+
+	return text.String(), nil
+}
+
+func (p *OpenAIProvider) newRequest(ctx context.Context, messages []Message, stream bool, schema *OutputSchema) (*http.Request, error) {
+	requestBody := OpenAIRequest{
+		Model:       p.model,
+		MaxTokens:   1000,
+		Temperature: 0.7,
+		Stream:      stream,
+	}
+	if stream {
+		requestBody.StreamOptions = &OpenAIStreamOptions{IncludeUsage: true}
+	}
+	// OpenAI 原生支持 system 角色，消息按原样发送
+	for _, msg := range messages {
+		requestBody.Messages = append(requestBody.Messages, OpenAIMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+	if schema != nil {
+		requestBody.ResponseFormat = &OpenAIResponseFormat{
+			Type: "json_schema",
+			JSONSchema: &OpenAIJSONSchema{
+				Name:        schema.Name,
+				Description: schema.Description,
+				Schema:      schema.Schema,
+				Strict:      true,
+			},
+		}
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.chatURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	p.authorize(req)
+
+	return req, nil
+}
 
-	resp, err := p.client.Do(req)
+func (p *OpenAIProvider) GetAvailableModels(ctx context.Context) ([]string, error) {
+	resp, err := sendWithRetry(ctx, p.client, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+		return req, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -141,10 +305,6 @@ func (p *OpenAIProvider) GetAvailableModels() ([]string, error) {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var response OpenAIModelsResponse
 	if err := json.Unmarshal(body, &response); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
@@ -0,0 +1,68 @@
+package ai
+
+import (
+	"context"
+
+	"github.com/xian/xsh/internal/redact"
+)
+
+// redactingProvider 在消息发往提供商之前替换其中的密钥，并把回复中的占位符换回原值，
+// 返回给调用方的文本和会话历史都不含占位符。换回了密钥的结果不写入磁盘缓存，见 Client.sensitive
+type redactingProvider struct {
+	Provider
+	redactor *redact.Redactor
+}
+
+// redactingStructuredProvider 为支持结构化输出的提供商保留 StructuredProvider 接口
+type redactingStructuredProvider struct {
+	redactingProvider
+	structured StructuredProvider
+}
+
+// redacting 为 provider 加上密钥脱敏，未启用脱敏时原样返回
+func (c *Client) redacting(provider Provider) Provider {
+	if c.redactor == nil {
+		return provider
+	}
+	p := redactingProvider{Provider: provider, redactor: c.redactor}
+	if structured, ok := provider.(StructuredProvider); ok {
+		return redactingStructuredProvider{redactingProvider: p, structured: structured}
+	}
+	return p
+}
+
+func (p redactingProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	text, err := p.Provider.Chat(ctx, p.redact(messages))
+	return p.redactor.Restore(text), err
+}
+
+func (p redactingProvider) ChatStream(ctx context.Context, messages []Message, onChunk StreamHandler) (string, error) {
+	// 流结束时输出还保留在 StreamRestorer 中的文本
+	if onChunk != nil {
+		write, flush := redact.StreamRestorer(p.redactor.Restore, onChunk)
+		defer flush()
+		onChunk = write
+	}
+	text, err := p.Provider.ChatStream(ctx, p.redact(messages), onChunk)
+	return p.redactor.Restore(text), err
+}
+
+func (p redactingStructuredProvider) ChatStructured(ctx context.Context, messages []Message, schema OutputSchema, onChunk StreamHandler) (string, error) {
+	// 结构化输出是 JSON 文本，换回的密钥需要按 JSON 字符串转义
+	if onChunk != nil {
+		write, flush := redact.StreamRestorer(p.redactor.RestoreJSON, onChunk)
+		defer flush()
+		onChunk = write
+	}
+	text, err := p.structured.ChatStructured(ctx, p.redact(messages), schema, onChunk)
+	return p.redactor.RestoreJSON(text), err
+}
+
+// redact 返回替换掉密钥的消息副本
+func (p redactingProvider) redact(messages []Message) []Message {
+	redacted := make([]Message, len(messages))
+	for i, msg := range messages {
+		redacted[i] = Message{Role: msg.Role, Content: p.redactor.Redact(msg.Content)}
+	}
+	return redacted
+}
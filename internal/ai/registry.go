@@ -0,0 +1,88 @@
+package ai
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/xian/xsh/internal/config"
+)
+
+// ProviderFactory 根据模型配置创建提供商实例
+type ProviderFactory func(cfg config.ModelConfig) (Provider, error)
+
+// Capabilities 描述提供商支持的可选能力
+type Capabilities struct {
+	Streaming        bool // 支持 ChatStream 增量输出
+	ModelDiscovery   bool // GetAvailableModels 会查询服务端的实时模型列表
+	Local            bool // 请求不会离开本机或内网
+	StructuredOutput bool // 实现了 StructuredProvider，可按 JSON schema 输出
+	// StructuredModel 判断具体模型是否支持结构化输出，为 nil 时所有模型都支持
+	StructuredModel func(model string) bool
+}
+
+// ProviderSpec 是提供商在注册表中的登记信息
+type ProviderSpec struct {
+	Name         string
+	Factory      ProviderFactory
+	Schema       config.ProviderSchema
+	Capabilities Capabilities
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]ProviderSpec)
+)
+
+// Register 以 spec.Name 注册一个提供商，并把它的环境变量描述交给 config.Load 使用。
+// 重复注册同名提供商会 panic，通常在提供商文件的 init 中调用
+func Register(spec ProviderSpec) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if spec.Name == "" || spec.Factory == nil {
+		panic("ai: Register requires a provider name and factory")
+	}
+	if _, exists := registry[spec.Name]; exists {
+		panic("ai: Register called twice for provider " + spec.Name)
+	}
+
+	spec.Schema.Name = spec.Name
+	registry[spec.Name] = spec
+	config.RegisterProvider(spec.Schema)
+}
+
+// LookupProvider 按名称查找已注册的提供商
+func LookupProvider(name string) (ProviderSpec, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	spec, exists := registry[name]
+	return spec, exists
+}
+
+// RegisteredProviders 返回所有已注册提供商的名称
+func RegisteredProviders() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newProvider 通过注册表为模型配置创建提供商
+func newProvider(modelConfig config.ModelConfig) (Provider, ProviderSpec, error) {
+	spec, exists := LookupProvider(modelConfig.Provider)
+	if !exists {
+		return nil, ProviderSpec{}, fmt.Errorf("unsupported AI provider: %s", modelConfig.Provider)
+	}
+
+	provider, err := spec.Factory(modelConfig)
+	if err != nil {
+		return nil, spec, fmt.Errorf("failed to create AI provider: %w", err)
+	}
+	return provider, spec, nil
+}
@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// TestReadSSE 检查无论数据在哪里切分，读到的事件都相同
+func TestReadSSE(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    []string
+	}{
+		{
+			name:    "events",
+			payload: "event: message_start\ndata: {\"a\":1}\n\nevent: content_block_delta\ndata: {\"text\":\"列出 😀\"}\n\n",
+			want:    []string{`message_start {"a":1}`, `content_block_delta {"text":"列出 😀"}`},
+		},
+		{
+			name:    "data only",
+			payload: "data: {\"x\":1}\n\ndata: [DONE]\n\n",
+			want:    []string{` {"x":1}`, ` [DONE]`},
+		},
+		{
+			name:    "crlf and comments",
+			payload: ": keep-alive\r\n\r\nevent: ping\r\ndata: {}\r\n\r\n",
+			want:    []string{`ping {}`},
+		},
+		{
+			name:    "multi-line data",
+			payload: "data: first\ndata:second\n\n",
+			want:    []string{" first\nsecond"},
+		},
+		{
+			name:    "no trailing blank line",
+			payload: "event: done\ndata: last",
+			want:    []string{"done last"},
+		},
+		{
+			name:    "event without data",
+			payload: "event: ignored\n\ndata: kept\n\n",
+			want:    []string{" kept"},
+		},
+	}
+	read := func(r io.Reader) ([]string, error) {
+		var events []string
+		err := readSSE(r, func(event, data string) error {
+			events = append(events, event+" "+data)
+			return nil
+		})
+		return events, err
+	}
+	for _, tt := range tests {
+		readers := map[string]func() io.Reader{
+			"whole":        func() io.Reader { return strings.NewReader(tt.payload) },
+			"byte by byte": func() io.Reader { return iotest.OneByteReader(strings.NewReader(tt.payload)) },
+		}
+		for i := 0; i <= len(tt.payload); i++ {
+			readers[fmt.Sprintf("split at %d", i)] = func() io.Reader {
+				return io.MultiReader(strings.NewReader(tt.payload[:i]), strings.NewReader(tt.payload[i:]))
+			}
+		}
+		for how, newReader := range readers {
+			got, err := read(newReader())
+			if err != nil {
+				t.Errorf("%s (%s): %v", tt.name, how, err)
+				continue
+			}
+			if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+				t.Errorf("%s (%s): got %q, want %q", tt.name, how, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xian/xsh/internal/risk"
+)
+
+// Suggestion 是一次命令建议的结构化结果
+type Suggestion struct {
+	Message  string             `json:"message"`
+	Commands []SuggestedCommand `json:"commands"`
+}
+
+// SuggestedCommand 是一条候选命令及其说明
+type SuggestedCommand struct {
+	Command     string   `json:"command"`
+	Description string   `json:"description"`
+	ProposedBy  []string `json:"-"` // 共识模式下提出该命令的模型，形如 provider/model
+	// Undocumented 是命令中本机手册页或 --help 输出里找不到的选项
+	Undocumented []string `json:"-"`
+	// Risks 说明命令中的危险操作（如递归删除根目录、写入磁盘设备），选中前需要用户确认
+	Risks []string `json:"-"`
+}
+
+// assessRisks 标出每条候选命令中的危险操作
+func assessRisks(suggestion *Suggestion) {
+	for i := range suggestion.Commands {
+		suggestion.Commands[i].Risks = risk.Assess(suggestion.Commands[i].Command)
+	}
+}
+
+// OutputSchema 描述要求模型输出的 JSON 结构
+type OutputSchema struct {
+	Name        string
+	Description string
+	Schema      map[string]any // 标准 JSON Schema
+}
+
+// StructuredProvider 由支持结构化输出的提供商实现（Anthropic 工具调用、OpenAI json_schema、Gemini responseSchema）。
+// 返回符合 schema 的 JSON 文本；onChunk 不为 nil 时流式返回 JSON 的增量片段
+type StructuredProvider interface {
+	ChatStructured(ctx context.Context, messages []Message, schema OutputSchema, onChunk StreamHandler) (string, error)
+}
+
+// suggestionSchema 是命令建议的输出结构
+var suggestionSchema = OutputSchema{
+	Name:        "shell_suggestion",
+	Description: "Suggest shell commands for the user's request.",
+	Schema: map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"message", "commands"},
+		"properties": map[string]any{
+			"message": map[string]any{
+				"type":        "string",
+				"description": "A brief, one-line, friendly explanation of what the commands do.",
+			},
+			"commands": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type":                 "object",
+					"additionalProperties": false,
+					"required":             []string{"command", "description"},
+					"properties": map[string]any{
+						"command": map[string]any{
+							"type":        "string",
+							"description": "The raw shell command, without '$' prefix or comments.",
+						},
+						"description": map[string]any{
+							"type":        "string",
+							"description": "What this command does or how it differs from the alternatives.",
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+// 文本格式回复中的段落标记
+const (
+	userMsgPrefix  = "USER_MESSAGE:"
+	shellCmdPrefix = "SHELL_COMMANDS:"
+)
+
+// ParseSuggestion 解析模型回复：优先按 JSON 解析，否则按 USER_MESSAGE / SHELL_COMMANDS 文本标记解析。
+// 没有解析出任何命令时返回 false
+func ParseSuggestion(response string) (Suggestion, bool) {
+	if suggestion, ok := parseJSONSuggestion(response); ok {
+		return suggestion, true
+	}
+	return parseTextSuggestion(response)
+}
+
+func parseJSONSuggestion(response string) (Suggestion, bool) {
+	trimmed := strings.TrimSpace(response)
+	// 部分模型会把 JSON 包在 ```json 代码块中
+	trimmed = strings.TrimPrefix(trimmed, "```json")
+	trimmed = strings.TrimPrefix(trimmed, "```")
+	trimmed = strings.TrimSuffix(trimmed, "```")
+	trimmed = strings.TrimSpace(trimmed)
+	if !strings.HasPrefix(trimmed, "{") {
+		return Suggestion{}, false
+	}
+
+	var suggestion Suggestion
+	if err := json.Unmarshal([]byte(trimmed), &suggestion); err != nil {
+		return Suggestion{}, false
+	}
+
+	var commands []SuggestedCommand
+	for _, cmd := range suggestion.Commands {
+		cmd.Command = strings.TrimSpace(cmd.Command)
+		cmd.Description = strings.TrimSpace(cmd.Description)
+		if cmd.Command != "" {
+			commands = append(commands, cmd)
+		}
+	}
+	suggestion.Message = strings.TrimSpace(suggestion.Message)
+	suggestion.Commands = commands
+	return suggestion, len(commands) > 0
+}
+
+func parseTextSuggestion(response string) (Suggestion, bool) {
+	var suggestion Suggestion
+
+	shellCmdStart := strings.Index(response, shellCmdPrefix)
+	if shellCmdStart == -1 {
+		return suggestion, false // No commands found, parsing failed.
+	}
+
+	userMsgStart := strings.Index(response, userMsgPrefix)
+	if userMsgStart != -1 && userMsgStart < shellCmdStart {
+		suggestion.Message = strings.TrimSpace(response[userMsgStart+len(userMsgPrefix) : shellCmdStart])
+	}
+
+	cmdBlock := strings.TrimSpace(response[shellCmdStart+len(shellCmdPrefix):])
+	for _, cmd := range strings.Split(cmdBlock, "\n") {
+		if trimmed := strings.TrimSpace(cmd); trimmed != "" {
+			suggestion.Commands = append(suggestion.Commands, SuggestedCommand{Command: trimmed})
+		}
+	}
+
+	return suggestion, len(suggestion.Commands) > 0
+}
+
+// textMessageStreamer 从文本格式的流式回复中增量提取 USER_MESSAGE 段落，
+// 使说明文字在模型仍在输出 SHELL_COMMANDS 时就能显示
+type textMessageStreamer struct {
+	buf     strings.Builder
+	printed int  // buf 中已输出到的位置
+	started bool // 是否已经输出过说明文字
+	done    bool // 是否已经遇到 SHELL_COMMANDS 标记
+	emit    StreamHandler
+}
+
+func (m *textMessageStreamer) Feed(chunk string) {
+	m.buf.WriteString(chunk)
+	if m.done {
+		return
+	}
+
+	response := m.buf.String()
+	msgStart := strings.Index(response, userMsgPrefix)
+	if msgStart == -1 {
+		return
+	}
+	msgStart += len(userMsgPrefix)
+
+	end := len(response)
+	if cmdStart := strings.Index(response[msgStart:], shellCmdPrefix); cmdStart != -1 {
+		end = msgStart + cmdStart
+		m.done = true
+	} else {
+		// 保留足够的字节，避免把尚未收全的标记输出出去
+		end -= len(shellCmdPrefix)
+		for end > msgStart && end < len(response) && !utf8.RuneStart(response[end]) {
+			end--
+		}
+	}
+
+	if m.printed < msgStart {
+		m.printed = msgStart
+	}
+	if end <= m.printed {
+		return
+	}
+
+	// 末尾的空白要等后面有文字时才输出，这样 SHELL_COMMANDS 前的空行不会被显示
+	text := strings.TrimRightFunc(response[m.printed:end], unicode.IsSpace)
+	if m.done {
+		m.printed = end
+	} else {
+		m.printed += len(text)
+	}
+	if !m.started {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	}
+	if text == "" {
+		return
+	}
+
+	m.emit(text)
+	m.started = true
+}
+
+// jsonMessageStreamer 从流式 JSON 回复中增量解码顶层 "message" 字段的字符串值
+type jsonMessageStreamer struct {
+	buf     strings.Builder
+	pos     int // 下一个待解码字节在 buf 中的位置，-1 表示尚未找到字段
+	done    bool
+	emit    StreamHandler
+	pending []byte // 解码出但尚未组成完整 UTF-8 字符的字节
+}
+
+func newJSONMessageStreamer(emit StreamHandler) *jsonMessageStreamer {
+	return &jsonMessageStreamer{pos: -1, emit: emit}
+}
+
+func (m *jsonMessageStreamer) Feed(chunk string) {
+	m.buf.WriteString(chunk)
+	if m.done {
+		return
+	}
+
+	data := m.buf.String()
+	if m.pos == -1 {
+		m.pos = findJSONStringValue(data, "message")
+		if m.pos == -1 {
+			return
+		}
+	}
+
+	var out []byte
+	i := m.pos
+decode:
+	for i < len(data) && !m.done {
+		switch c := data[i]; c {
+		case '"':
+			m.done = true
+			i++
+		case '\\':
+			n := jsonEscapeLen(data[i:])
+			if n == 0 {
+				break decode // 转义序列不完整，等待后续数据
+			}
+			var decoded string
+			if err := json.Unmarshal([]byte(`"`+data[i:i+n]+`"`), &decoded); err == nil {
+				out = append(out, decoded...)
+			}
+			i += n
+		default:
+			out = append(out, c)
+			i++
+		}
+	}
+	m.pos = i
+
+	m.pending = append(m.pending, out...)
+	valid := len(m.pending)
+	if !m.done {
+		// 末尾可能是尚未收全的多字节字符，留到下次输出
+		for k := 1; k <= utf8.UTFMax && k <= valid; k++ {
+			if utf8.RuneStart(m.pending[valid-k]) {
+				if !utf8.FullRune(m.pending[valid-k:]) {
+					valid -= k
+				}
+				break
+			}
+		}
+	}
+	if valid > 0 {
+		m.emit(string(m.pending[:valid]))
+		m.pending = m.pending[valid:]
+	}
+}
+
+// jsonEscapeLen 返回以反斜杠开头的 JSON 转义序列长度，数据不完整时返回 0。
+// UTF-16 代理对（如 \ud83d\ude00）作为一个整体返回
+func jsonEscapeLen(data string) int {
+	if len(data) < 2 {
+		return 0
+	}
+	if data[1] != 'u' {
+		return 2
+	}
+	if len(data) < 6 {
+		return 0
+	}
+	if hi := strings.ToLower(data[2:4]); hi >= "d8" && hi <= "db" {
+		if len(data) < 12 {
+			return 0
+		}
+		return 12
+	}
+	return 6
+}
+
+// findJSONStringValue 返回 JSON 文本中 "key": " 之后字符串内容的起始位置，未找到时返回 -1
+func findJSONStringValue(data, key string) int {
+	needle := `"` + key + `"`
+	offset := 0
+	for {
+		idx := strings.Index(data[offset:], needle)
+		if idx == -1 {
+			return -1
+		}
+		i := offset + idx + len(needle)
+		for i < len(data) && unicode.IsSpace(rune(data[i])) {
+			i++
+		}
+		if i >= len(data) {
+			return -1
+		}
+		if data[i] != ':' {
+			offset = i
+			continue
+		}
+		i++
+		for i < len(data) && unicode.IsSpace(rune(data[i])) {
+			i++
+		}
+		if i >= len(data) {
+			return -1
+		}
+		if data[i] != '"' {
+			offset = i
+			continue
+		}
+		return i + 1
+	}
+}
@@ -0,0 +1,95 @@
+package ai
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// streamOutput 把 chunks 依次交给 newFeed 创建的流式解析器，返回输出的全部文本
+func streamOutput(newFeed func(emit StreamHandler) StreamHandler, chunks ...string) string {
+	var out strings.Builder
+	feed := newFeed(func(text string) { out.WriteString(text) })
+	for _, chunk := range chunks {
+		feed(chunk)
+	}
+	return out.String()
+}
+
+// checkSplits 检查 payload 不切分、在每个字节处切成两段以及逐字节输入时，解析器的输出都是 want
+func checkSplits(t *testing.T, name string, newFeed func(emit StreamHandler) StreamHandler, payload, want string) {
+	t.Helper()
+	if got := streamOutput(newFeed, payload); got != want {
+		t.Errorf("%s: got %q, want %q", name, got, want)
+		return
+	}
+	for i := 0; i <= len(payload); i++ {
+		if got := streamOutput(newFeed, payload[:i], payload[i:]); got != want {
+			t.Errorf("%s: split at %d: got %q, want %q", name, i, got, want)
+		}
+	}
+	bytes := make([]string, len(payload))
+	for i := 0; i < len(payload); i++ {
+		bytes[i] = payload[i : i+1]
+	}
+	if got := streamOutput(newFeed, bytes...); got != want {
+		t.Errorf("%s: byte by byte: got %q, want %q", name, got, want)
+	}
+}
+
+// TestJSONMessageStreamer 检查无论流在哪里切分，增量解码出的 message 都相同
+func TestJSONMessageStreamer(t *testing.T) {
+	newFeed := func(emit StreamHandler) StreamHandler { return newJSONMessageStreamer(emit).Feed }
+	encode := func(message string) string {
+		data, _ := json.Marshal(Suggestion{Message: message, Commands: []SuggestedCommand{{Command: "ls", Description: "列出文件"}}})
+		return string(data)
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"plain", encode("List the files."), "List the files."},
+		{"utf-8", encode("列出当前目录下的文件 😀"), "列出当前目录下的文件 😀"},
+		{"escapes", `{"message": "say \"hi\"\n\ttab \\ done", "commands": []}`, "say \"hi\"\n\ttab \\ done"},
+		{"unicode escapes", `{"message":"caf\u00e9 \ud83d\ude00 \u003cSECRET_1\u003e","commands":[]}`, "café 😀 <SECRET_1>"},
+		{"whitespace around colon", "{\n  \"message\" :\n  \"hello\"\n}", "hello"},
+		{"message after commands", `{"commands":[{"command":"echo message","description":"\"message\""}],"message":"late"}`, "late"},
+		{"empty message", `{"message":"","commands":[]}`, ""},
+		{"not json", "USER_MESSAGE:\nhello\n\nSHELL_COMMANDS:\nls\n", ""},
+	}
+	for _, tt := range tests {
+		checkSplits(t, tt.name, newFeed, tt.payload, tt.want)
+	}
+}
+
+// TestTextMessageStreamer 检查无论流在哪里切分，输出的 USER_MESSAGE 段落都相同
+func TestTextMessageStreamer(t *testing.T) {
+	newFeed := func(emit StreamHandler) StreamHandler { return (&textMessageStreamer{emit: emit}).Feed }
+
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"plain", "USER_MESSAGE:\nList the files.\n\nSHELL_COMMANDS:\nls -la\n", "List the files."},
+		{"utf-8", "USER_MESSAGE: 列出文件 😀\n\nSHELL_COMMANDS:\nls\n", "列出文件 😀"},
+		{"multi-line", "USER_MESSAGE:\nfirst line\n\n  second line\nSHELL_COMMANDS:\nls", "first line\n\n  second line"},
+		{"preamble", "Sure!\nUSER_MESSAGE:\nhi\nSHELL_COMMANDS:\nls", "hi"},
+		{"commands only", "SHELL_COMMANDS:\nls\n", ""},
+		// 模型没有按格式回答时不输出任何内容，由调用方显示原始回复
+		{"unstructured", "You can use ls -la to list the files in the current directory.", ""},
+	}
+	for _, tt := range tests {
+		checkSplits(t, tt.name, newFeed, tt.payload, tt.want)
+	}
+
+	// 没有 SHELL_COMMANDS 时保留末尾可能是标记开头的部分，切分位置不影响已输出的内容
+	payload := "USER_MESSAGE:\nThe answer is that there are no commands for this.\n"
+	want := streamOutput(newFeed, payload)
+	if !strings.HasPrefix(payload[len(userMsgPrefix)+1:], want) || want == "" {
+		t.Fatalf("missing commands: got %q", want)
+	}
+	checkSplits(t, "missing commands", newFeed, payload, want)
+}
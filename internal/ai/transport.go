@@ -0,0 +1,255 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrorKind 是对提供商调用失败原因的分类
+type ErrorKind int
+
+const (
+	ErrorUnknown       ErrorKind = iota
+	ErrorRateLimit               // 429 或提供商的限流错误
+	ErrorOverloaded              // 服务过载，如 Anthropic 的 529 / overloaded_error
+	ErrorServer                  // 其他 5xx
+	ErrorNetwork                 // 连接被重置、意外断开等网络错误
+	ErrorTimeout                 // 单次请求或调用方 deadline 超时
+	ErrorCanceled                // 调用方主动取消
+	ErrorAuth                    // 401 / 403
+	ErrorModelNotFound           // 模型不存在或无权访问
+	ErrorBadRequest              // 其他 4xx
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorRateLimit:
+		return "rate_limit"
+	case ErrorOverloaded:
+		return "overloaded"
+	case ErrorServer:
+		return "server_error"
+	case ErrorNetwork:
+		return "network"
+	case ErrorTimeout:
+		return "timeout"
+	case ErrorCanceled:
+		return "canceled"
+	case ErrorAuth:
+		return "auth"
+	case ErrorModelNotFound:
+		return "model_not_found"
+	case ErrorBadRequest:
+		return "bad_request"
+	default:
+		return "unknown"
+	}
+}
+
+// Retryable 表示该类错误是否值得原样重试
+func (k ErrorKind) Retryable() bool {
+	switch k {
+	case ErrorRateLimit, ErrorOverloaded, ErrorServer, ErrorNetwork, ErrorTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// APIError 表示提供商返回了非 2xx 响应
+type APIError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+	Kind       ErrorKind
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	lowerBody := strings.ToLower(apiErr.Body)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		apiErr.Kind = ErrorRateLimit
+	case resp.StatusCode == 529 || strings.Contains(lowerBody, "overloaded"):
+		apiErr.Kind = ErrorOverloaded
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		apiErr.Kind = ErrorAuth
+	case resp.StatusCode == http.StatusNotFound ||
+		strings.Contains(lowerBody, "model_not_found") ||
+		strings.Contains(lowerBody, "does not exist"):
+		apiErr.Kind = ErrorModelNotFound
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusGatewayTimeout:
+		apiErr.Kind = ErrorTimeout
+	case resp.StatusCode >= 500:
+		apiErr.Kind = ErrorServer
+	case resp.StatusCode >= 400:
+		apiErr.Kind = ErrorBadRequest
+	}
+	return apiErr
+}
+
+// parseRetryAfter 解析 Retry-After 头，支持秒数和 HTTP 日期两种格式
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// ClassifyError 判断一次提供商调用失败的原因
+func ClassifyError(err error) ErrorKind {
+	if err == nil {
+		return ErrorUnknown
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Kind
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) {
+		return ErrorNetwork
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return ErrorNetwork
+	}
+
+	// 部分提供商在响应体中返回错误（如流式事件），只能按文本判断
+	message := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(message, "overloaded"):
+		return ErrorOverloaded
+	case strings.Contains(message, "rate limit") || strings.Contains(message, "rate_limit"):
+		return ErrorRateLimit
+	case strings.Contains(message, "model_not_found") || strings.Contains(message, "does not exist"):
+		return ErrorModelNotFound
+	}
+	return ErrorUnknown
+}
+
+// RetryPolicy 控制提供商 HTTP 请求的重试行为
+type RetryPolicy struct {
+	MaxAttempts int           // 包括第一次请求在内的最大尝试次数
+	BaseDelay   time.Duration // 第一次重试前的基础等待时间
+	MaxDelay    time.Duration // 单次退避等待的上限
+	// MaxRetryAfter 是愿意按 Retry-After 等待的上限，服务端要求等待更久时直接返回错误，
+	// 由调用方切换到备用模型
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy 是所有提供商共用的重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:   4,
+	BaseDelay:     500 * time.Millisecond,
+	MaxDelay:      8 * time.Second,
+	MaxRetryAfter: 20 * time.Second,
+}
+
+// backoff 返回第 attempt 次重试前带抖动的指数退避时间
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << attempt
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	// 等值抖动：在 [delay/2, delay) 之间随机，避免多个客户端同时重试
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// sendWithRetry 发送请求并对可重试的错误按退避策略重试。
+// newRequest 在每次尝试时重新构造请求，保证请求体可以被重复发送；
+// 成功时返回 2xx 响应，失败时返回 *APIError 或网络错误
+func sendWithRetry(ctx context.Context, client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	policy := DefaultRetryPolicy
+
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		var retryAfter time.Duration
+		resp, err := client.Do(req)
+		if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("failed to send request: %w", ctx.Err())
+			}
+			err = fmt.Errorf("failed to send request: %w", err)
+		} else {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+			apiErr := newAPIError(resp, body)
+			retryAfter = apiErr.RetryAfter
+			err = apiErr
+		}
+
+		if attempt+1 >= policy.MaxAttempts || !ClassifyError(err).Retryable() || retryAfter > policy.MaxRetryAfter {
+			return nil, err
+		}
+
+		delay := policy.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		// 等待会超过调用方的 deadline 时不再重试，直接返回本次错误
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
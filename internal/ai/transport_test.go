@@ -0,0 +1,65 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestSendWithRetryLongRetryAfter 检查 Retry-After 超过上限时不等待，直接返回限流错误
+func TestSendWithRetryLongRetryAfter(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	_, err := sendWithRetry(context.Background(), server.Client(), func() (*http.Request, error) {
+		return http.NewRequest(http.MethodPost, server.URL, nil)
+	})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("sendWithRetry waited %v", elapsed)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("err = %v, want a 429 APIError", err)
+	}
+	if ClassifyError(err) != ErrorRateLimit {
+		t.Errorf("ClassifyError = %v, want %v", ClassifyError(err), ErrorRateLimit)
+	}
+	if calls != 1 {
+		t.Errorf("server called %d times, want 1", calls)
+	}
+}
+
+// TestSendWithRetryShortRetryAfter 检查上限以内的 Retry-After 照常重试
+func TestSendWithRetryShortRetryAfter(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	resp, err := sendWithRetry(context.Background(), server.Client(), func() (*http.Request, error) {
+		return http.NewRequest(http.MethodPost, server.URL, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if calls != 2 {
+		t.Errorf("server called %d times, want 2", calls)
+	}
+}
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xian/xsh/internal/config"
+	"github.com/xian/xsh/internal/usage"
+)
+
+type usageKey struct{}
+
+// usageRecorder 收集一次提供商调用中报告的 token 用量
+type usageRecorder struct {
+	mu     sync.Mutex
+	tokens usage.Tokens
+}
+
+func (r *usageRecorder) Tokens() usage.Tokens {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tokens
+}
+
+// withUsageRecorder 返回一个可以通过 ReportUsage 记录用量的 context
+func withUsageRecorder(ctx context.Context) (context.Context, *usageRecorder) {
+	recorder := &usageRecorder{}
+	return context.WithValue(ctx, usageKey{}, recorder), recorder
+}
+
+// ReportUsage 由提供商在解析到 token 用量时调用。流式响应中用量可能分多次到达
+// （如 Anthropic 的 message_start / message_delta），每次以非零的最新值为准
+func ReportUsage(ctx context.Context, input, output int) {
+	recorder, ok := ctx.Value(usageKey{}).(*usageRecorder)
+	if !ok {
+		return
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if input > 0 {
+		recorder.tokens.Input = input
+	}
+	if output > 0 {
+		recorder.tokens.Output = output
+	}
+}
+
+// accountant 计算每次请求的费用，累计会话用量并写入持久化的用量日志
+type accountant struct {
+	mu      sync.Mutex
+	prices  usage.Prices
+	log     *usage.Log
+	session usage.Summary
+}
+
+func newAccountant(cfg *config.Config) *accountant {
+	// 价格表文件有误时仍使用默认价格，用量统计不应该影响查询
+	prices, _ := usage.LoadPrices(cfg.Usage.PricesFile)
+	a := &accountant{prices: prices}
+	if cfg.Usage.LogFile != "" {
+		a.log = usage.NewLog(cfg.Usage.LogFile)
+	}
+	return a
+}
+
+// record 计算 response 的费用并计入会话和用量日志。failed 表示请求失败或被取消，回答没有被使用
+func (a *accountant) record(response *Response, failed bool) {
+	response.Cost, response.Priced = a.prices.Cost(response.Model, response.Usage)
+
+	record := usage.Record{
+		Time:     time.Now(),
+		Provider: response.Provider,
+		Model:    response.Model,
+		Tokens:   response.Usage,
+		Cost:     response.Cost,
+		Failed:   failed,
+	}
+
+	a.mu.Lock()
+	a.session.Add(record)
+	a.mu.Unlock()
+
+	if a.log != nil {
+		a.log.Append(record)
+	}
+}
+
+// SessionUsage 返回本次 xsh 会话中所有请求的用量汇总（不含缓存命中）
+func (c *Client) SessionUsage() usage.Summary {
+	c.usage.mu.Lock()
+	defer c.usage.mu.Unlock()
+	return c.usage.session
+}
@@ -0,0 +1,70 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xian/xsh/internal/config"
+	"github.com/xian/xsh/internal/usage"
+)
+
+// TestUsageRecordsHedgeLoser 检查对冲请求中落选、被取消的请求报告过的用量同样计入会话
+func TestUsageRecordsHedgeLoser(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "text/event-stream")
+		event := func(v any) {
+			data, _ := json.Marshal(v)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			w.(http.Flusher).Flush()
+		}
+
+		if req.Model == "gpt-4o" {
+			// 主模型先报告用量，然后迟迟不给出回答，直到请求被取消
+			event(map[string]any{"choices": []any{}, "usage": map[string]int{"prompt_tokens": 100, "completion_tokens": 5}})
+			<-r.Context().Done()
+			return
+		}
+		content := `{"message":"Done.","commands":[{"command":"ls","description":""}]}`
+		event(map[string]any{"choices": []any{map[string]any{"delta": map[string]string{"content": content}}}})
+		event(map[string]any{"choices": []any{}, "usage": map[string]int{"prompt_tokens": 10, "completion_tokens": 2}})
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+	useFakeOpenAI(t, server.URL)
+	t.Setenv("XSH_CACHE", "off")
+	t.Setenv("XSH_HEDGE", "openai:gpt-4o-mini")
+	t.Setenv("XSH_HEDGE_DELAY", "50ms")
+
+	client := New(config.Load())
+	response, err := client.Suggest(context.Background(), "list files", func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Hedged || response.Usage != (usage.Tokens{Input: 10, Output: 2}) {
+		t.Fatalf("response = hedged %v, usage %+v; want the backup's answer", response.Hedged, response.Usage)
+	}
+
+	// 落选的请求在 Suggest 返回后才结束
+	want := usage.Summary{Queries: 1, Tokens: usage.Tokens{Input: 110, Output: 7}}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		session := client.SessionUsage()
+		session.Cost = 0
+		if session == want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("session usage = %+v, want %+v", session, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -2,14 +2,77 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	CurrentModel    string
-	Models          map[string]ModelConfig
-	AnthropicAPIKey string
-	GoogleAPIKey    string
-	OpenAIAPIKey    string
+	CurrentModel string
+	Models       map[string]ModelConfig
+	Fallbacks    []FallbackLink
+	Consensus    []ModelRef // 共识模式下同时询问的模型，少于两个时不启用
+	Hedge        HedgeConfig
+	Timeout      time.Duration // 单个模型请求的超时时间，0 表示不限制
+	Grounding    GroundingConfig
+	Fix          FixConfig
+	Redact       RedactConfig
+	CacheDir     string
+	Cache        CacheConfig
+	ConfigDir    string
+	TrustedDirs  []string // 允许读取 .xsh-prompt.tmpl 的目录（含子目录），为空时不读取目录模板
+	Usage        UsageConfig
+	Transport    TransportConfig
+}
+
+// HedgeConfig 控制对冲请求：主模型在 Delay 内没有回复时依次启动 Backups 中的模型
+type HedgeConfig struct {
+	Backups []ModelRef
+	Delay   time.Duration
+}
+
+// GroundingConfig 控制是否用本机的手册页和 --help 输出约束命令建议
+type GroundingConfig struct {
+	Enabled bool // 在提示中附上问题提到的程序的文档，并核对建议命令中的选项
+	Reask   bool // 建议使用了文档中没有的选项时，附上文档重新询问一次
+}
+
+// FixConfig 控制修正上一条命令的模式
+type FixConfig struct {
+	Key  string // 触发修正的 zsh 按键序列（bindkey 格式）
+	Auto bool   // 命令以非零状态退出后自动询问是否修正
+}
+
+// RedactConfig 控制发往提供商之前的密钥脱敏
+type RedactConfig struct {
+	Enabled      bool
+	PatternsFile string  // 自定义检测规则，每行一个正则表达式
+	Entropy      float64 // 熵检测阈值（每字符比特数），0 表示关闭熵检测
+}
+
+// CacheConfig 控制查询结果和模型列表的磁盘缓存
+type CacheConfig struct {
+	Enabled  bool
+	TTL      time.Duration
+	MaxBytes int64
+	// CatalogTTL 是模型列表缓存的刷新间隔，与 Enabled 无关，模型列表总是会被缓存
+	CatalogTTL time.Duration
+}
+
+// TransportConfig 控制访问提供商时使用的代理和 TLS 设置
+type TransportConfig struct {
+	Proxy      string // http(s):// 或 socks5:// 代理地址，为空时使用 HTTPS_PROXY 等标准环境变量，"direct" 表示直连
+	CABundle   string // 额外信任的根证书（PEM），用于企业网关或中间人代理
+	ClientCert string // mTLS 客户端证书（PEM）
+	ClientKey  string // 客户端证书私钥（PEM），为空时从 ClientCert 中读取
+}
+
+// UsageConfig 指定 token 用量日志和价格表的位置
+type UsageConfig struct {
+	LogFile    string
+	PricesFile string
 }
 
 type ModelConfig struct {
@@ -17,58 +80,118 @@ type ModelConfig struct {
 	APIKey   string
 	BaseURL  string
 	Model    string
+	Options  map[string]string // 提供商特有的设置，见 ProviderSchema.Options
 }
 
-// Load 从环境变量加载配置
+// Load 从环境变量加载配置，所有已注册且配置齐全的提供商都会被加载
 func Load() *Config {
 	config := &Config{
-		CurrentModel: getEnv("XSH_MODEL", "openai"),
+		CurrentModel: os.Getenv("XSH_MODEL"),
 		Models:       make(map[string]ModelConfig),
 	}
 
-	if apiKey := os.Getenv("ANTHROPIC_API_KEY"); apiKey != "" {
-		// Anthropic Claude 配置
-		config.Models["claude"] = ModelConfig{
-			Provider: "anthropic",
-			APIKey:   apiKey,
-			BaseURL:  getEnv("ANTHROPIC_BASE_URL", "https://api.anthropic.com"),
-			Model:    getEnv("ANTHROPIC_MODEL", "claude-3-sonnet-20240229"),
-		}
-		config.AnthropicAPIKey = apiKey
-		config.CurrentModel = "claude"
-	} else if apiKey := os.Getenv("GOOGLE_API_KEY"); apiKey != "" {
-		// Google Gemini 配置
-		config.Models["gemini"] = ModelConfig{
-			Provider: "google",
-			APIKey:   apiKey,
-			BaseURL:  getEnv("GOOGLE_BASE_URL", "https://generativelanguage.googleapis.com"),
-			Model:    getEnv("GOOGLE_MODEL", "gemini-pro"),
+	schemas := registeredSchemas()
+	for _, schema := range schemas {
+		modelConfig, ok := schema.load()
+		if ok {
+			config.Models[schema.Key] = modelConfig
 		}
-		config.GoogleAPIKey = apiKey
-		config.CurrentModel = "gemini"
-	} else if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
-		// OpenAI 配置
-		config.Models["openai"] = ModelConfig{
-			Provider: "openai",
-			APIKey:   apiKey,
-			BaseURL:  getEnv("OPENAI_BASE_URL", "https://api.openai.com/v1"),
-			Model:    getEnv("OPENAI_MODEL", "gpt-3.5-turbo"),
-		}
-		config.OpenAIAPIKey = apiKey
-		config.CurrentModel = "openai"
 	}
 
-	// 如果当前选择的模型不可用，选择第一个可用的模型
+	// XSH_MODEL 既可以是模型键名（如 "claude"），也可以是提供商名称（如 "anthropic"）
+	if key, exists := config.resolveModelKey(config.CurrentModel); exists {
+		config.CurrentModel = key
+	}
+
+	// 如果当前选择的模型不可用，按优先级选择第一个可用的模型
 	if _, exists := config.Models[config.CurrentModel]; !exists {
-		for name := range config.Models {
-			config.CurrentModel = name
-			break
+		config.CurrentModel = ""
+		for _, schema := range schemas {
+			if _, ok := config.Models[schema.Key]; ok {
+				config.CurrentModel = schema.Key
+				break
+			}
 		}
 	}
 
+	// 设置为空值可关闭默认的回退链
+	fallback, ok := os.LookupEnv("XSH_FALLBACK")
+	if !ok {
+		fallback = defaultFallback
+	}
+	config.Fallbacks = ParseFallbackChain(fallback)
+	config.Consensus = ParseModelList(os.Getenv("XSH_CONSENSUS"))
+	config.Hedge = HedgeConfig{
+		Backups: ParseModelList(os.Getenv("XSH_HEDGE")),
+		Delay:   getEnvDuration("XSH_HEDGE_DELAY", 1500*time.Millisecond),
+	}
+	config.Timeout = getEnvDuration("XSH_TIMEOUT", 60*time.Second)
+	config.Fix = FixConfig{
+		Key:  getEnv("XSH_FIX_KEY", `\e\e`),
+		Auto: getEnvBool("XSH_FIX_AUTO", false),
+	}
+	config.Grounding = GroundingConfig{
+		Enabled: getEnvBool("XSH_GROUNDING", true),
+		Reask:   getEnvBool("XSH_GROUNDING_REASK", true),
+	}
+
+	config.CacheDir = getEnv("XSH_CACHE_DIR", defaultCacheDir())
+	config.Cache = CacheConfig{
+		Enabled:  getEnvBool("XSH_CACHE", true),
+		TTL:      getEnvDuration("XSH_CACHE_TTL", 7*24*time.Hour),
+		MaxBytes: getEnvInt64("XSH_CACHE_MAX_BYTES", 5<<20),
+
+		CatalogTTL: getEnvDuration("XSH_MODEL_CATALOG_TTL", 24*time.Hour),
+	}
+
+	config.ConfigDir = getEnv("XSH_CONFIG_DIR", defaultConfigDir())
+	config.TrustedDirs = trustedDirs(os.Getenv("XSH_TRUSTED_DIRS"))
+	config.Redact = RedactConfig{
+		Enabled:      getEnvBool("XSH_REDACT", true),
+		PatternsFile: getEnv("XSH_REDACT_PATTERNS", filepath.Join(config.ConfigDir, "redact.txt")),
+		Entropy:      getEnvFloat("XSH_REDACT_ENTROPY", 3.5),
+	}
+	config.Usage = UsageConfig{
+		LogFile:    getEnv("XSH_USAGE_LOG", filepath.Join(config.ConfigDir, "usage.jsonl")),
+		PricesFile: getEnv("XSH_PRICES", filepath.Join(config.ConfigDir, "prices.json")),
+	}
+
+	config.Transport = TransportConfig{
+		Proxy:      os.Getenv("XSH_PROXY"),
+		CABundle:   os.Getenv("XSH_CA_BUNDLE"),
+		ClientCert: os.Getenv("XSH_CLIENT_CERT"),
+		ClientKey:  os.Getenv("XSH_CLIENT_KEY"),
+	}
+
 	return config
 }
 
+// resolveModelKey 将模型键名或提供商名称解析为 Models 中的键名
+func (c *Config) resolveModelKey(name string) (string, bool) {
+	if _, exists := c.Models[name]; exists {
+		return name, true
+	}
+	for _, key := range c.GetAvailableModels() {
+		if c.Models[key].Provider == name {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// ResolveModel 按模型键名或提供商名称查找已配置的模型，model 非空时替换具体模型名称
+func (c *Config) ResolveModel(name, model string) (ModelConfig, bool) {
+	key, exists := c.resolveModelKey(name)
+	if !exists {
+		return ModelConfig{}, false
+	}
+	modelConfig := c.Models[key]
+	if model != "" {
+		modelConfig.Model = model
+	}
+	return modelConfig, true
+}
+
 // GetCurrentModel 获取当前选择的模型配置
 func (c *Config) GetCurrentModel() (ModelConfig, bool) {
 	model, exists := c.Models[c.CurrentModel]
@@ -90,6 +213,7 @@ func (c *Config) GetAvailableModels() []string {
 	for name := range c.Models {
 		models = append(models, name)
 	}
+	sort.Strings(models)
 	return models
 }
 
@@ -101,59 +225,63 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-// GetSystemPrompt 获取系统提示词
-func GetSystemPrompt() string {
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "zsh"
+// getEnvBool 读取布尔型环境变量，支持 1/0、true/false、on/off
+func getEnvBool(key string, defaultValue bool) bool {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "1", "true", "on", "yes":
+		return true
+	case "0", "false", "off", "no":
+		return false
+	default:
+		return defaultValue
 	}
-	return `You are a shell assistant AI. Your task is to understand a user's natural language query and provide the corresponding shell command(s).
-
-Your response MUST be in the following format, with no other text or explanation outside of this format:
-
-USER_MESSAGE:
-<A brief, one-line, friendly explanation of what the commands do.>
-
-SHELL_COMMANDS:
-<The raw shell command(s). Provide one command per line. Do not include any explanations, comments, or '$' prefixes here. Only provide the commands.>
-
-Example:
-User query: "find all go files in the current directory and count them"
-
-Your response:
-USER_MESSAGE:
-Finds all Go files in the current directory and provides a count.
-
-SHELL_COMMANDS:
-find . -name "*.go" | wc -l
+}
 
-Current shell: ` + shell + `
-OS: ` + getOS()
+// getEnvDuration 读取时长型环境变量，如 "30s"、"24h"
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return defaultValue
 }
 
-func getOS() string {
-	if os := os.Getenv("OS"); os != "" {
-		return os
+// getEnvFloat 读取浮点型环境变量
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if f, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return f
 	}
-	if runtime := os.Getenv("GOOS"); runtime != "" {
-		return runtime
+	return defaultValue
+}
+
+// getEnvInt64 读取整数型环境变量
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if n, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil {
+		return n
 	}
-	return "unix-like"
+	return defaultValue
 }
 
-// HasAnthropicKey checks if the Anthropic API key is set
-func (c *Config) HasAnthropicKey() bool {
-	return c.AnthropicAPIKey != ""
+// defaultCacheDir 返回用户缓存目录下的 xsh 子目录
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "xsh")
 }
 
-// HasGoogleKey checks if the Google API key is set
-func (c *Config) HasGoogleKey() bool {
-	return c.GoogleAPIKey != ""
+// defaultConfigDir 返回用户配置目录下的 xsh 子目录
+func defaultConfigDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "xsh")
 }
 
-// HasOpenAIKey checks if the OpenAI API key is set
-func (c *Config) HasOpenAIKey() bool {
-	return c.OpenAIAPIKey != ""
+// HasModels checks if at least one provider is configured
+func (c *Config) HasModels() bool {
+	return len(c.Models) > 0
 }
 
 // ModelInfo 包含模型的显示信息
@@ -166,7 +294,8 @@ type ModelInfo struct {
 // GetAvailableModelInfos 获取所有可用模型的详细信息
 func (c *Config) GetAvailableModelInfos() []ModelInfo {
 	var models []ModelInfo
-	for key, modelConfig := range c.Models {
+	for _, key := range c.GetAvailableModels() {
+		modelConfig := c.Models[key]
 		models = append(models, ModelInfo{
 			Key:         key,
 			DisplayName: modelConfig.Model,
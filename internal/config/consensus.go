@@ -0,0 +1,33 @@
+package config
+
+import (
+	"strings"
+)
+
+// ModelRef 引用一个已配置的模型，格式为 name[:model]
+type ModelRef struct {
+	Name  string // 模型键名或提供商名称，如 "claude"、"openai"
+	Model string // 可选，替换该提供商配置的具体模型
+}
+
+// parseModelRef 解析 name[:model]
+func parseModelRef(value string) ModelRef {
+	var ref ModelRef
+	ref.Name, ref.Model, _ = strings.Cut(value, ":")
+	ref.Name = strings.TrimSpace(ref.Name)
+	ref.Model = strings.TrimSpace(ref.Model)
+	return ref
+}
+
+// ParseModelList 解析以逗号分隔的 name[:model] 列表，如 XSH_CONSENSUS：
+//
+//	claude, openai:gpt-4o, gemini
+func ParseModelList(value string) []ModelRef {
+	var refs []ModelRef
+	for _, entry := range strings.Split(value, ",") {
+		if ref := parseModelRef(entry); ref.Name != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
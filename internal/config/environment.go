@@ -0,0 +1,229 @@
+package config
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment 是对本机环境的探测结果，写入系统提示，避免模型给出其他系统上的命令
+type Environment struct {
+	OS             string // runtime.GOOS，如 "linux"、"darwin"
+	Arch           string
+	Distro         string // 发行版或系统版本，如 "Ubuntu 22.04.4 LTS"、"macOS 14.5"
+	DistroID       string // /etc/os-release 中的 ID，如 "ubuntu"
+	PackageManager string // 如 "apt"、"dnf"、"brew"，未找到时为空
+	Tools          []Tool
+}
+
+// Tool 描述一个常用命令在本机上的情况
+type Tool struct {
+	Name    string
+	Present bool
+	Core    bool   // GNU 与 BSD 实现的选项差别较大的核心工具
+	Variant string // 核心工具的实现，如 "GNU"、"BSD"、"BusyBox"，无法判断时为空
+}
+
+// coreTools 是 GNU 与 BSD 实现的选项差别较大的工具，需要探测具体实现
+var coreTools = []string{"ls", "grep", "sed", "awk", "find", "xargs", "tar", "date", "stat"}
+
+// extraTools 是只探测是否安装的常用工具
+var extraTools = []string{"rg", "fd", "jq", "curl", "wget", "git", "docker", "podman", "python3", "systemctl", "ip", "ss", "netstat", "lsof"}
+
+// packageManagers 按发行版 ID（及 ID_LIKE）给出首选的包管理器
+var packageManagers = map[string][]string{
+	"debian":   {"apt"},
+	"ubuntu":   {"apt"},
+	"fedora":   {"dnf", "yum"},
+	"rhel":     {"dnf", "yum"},
+	"centos":   {"dnf", "yum"},
+	"arch":     {"pacman"},
+	"opensuse": {"zypper"},
+	"suse":     {"zypper"},
+	"alpine":   {"apk"},
+	"nixos":    {"nix"},
+	"gentoo":   {"emerge"},
+	"void":     {"xbps-install"},
+	"darwin":   {"brew", "port"},
+	"freebsd":  {"pkg"},
+}
+
+// fallbackPackageManagers 是发行版未知时依次查找的包管理器
+var fallbackPackageManagers = []string{"apt", "dnf", "yum", "pacman", "zypper", "apk", "brew", "port", "pkg", "nix"}
+
+// probeTimeout 是探测单个工具版本的时间上限
+const probeTimeout = time.Second
+
+var (
+	probeOnce sync.Once
+	probed    Environment
+)
+
+// ProbeEnvironment 探测本机的系统、发行版、包管理器和常用工具，结果在进程内缓存
+func ProbeEnvironment() Environment {
+	probeOnce.Do(func() {
+		probed = probeEnvironment()
+	})
+	return probed
+}
+
+func probeEnvironment() Environment {
+	env := Environment{OS: runtime.GOOS, Arch: runtime.GOARCH}
+
+	var idLike []string
+	switch runtime.GOOS {
+	case "darwin":
+		env.DistroID = "darwin"
+		if version := commandOutput("sw_vers", "-productVersion"); version != "" {
+			env.Distro = "macOS " + version
+		}
+	default:
+		release := readOSRelease()
+		env.DistroID = release["ID"]
+		env.Distro = release["PRETTY_NAME"]
+		idLike = strings.Fields(release["ID_LIKE"])
+		if env.DistroID == "" {
+			env.DistroID = runtime.GOOS
+		}
+	}
+	env.PackageManager = findPackageManager(append([]string{env.DistroID}, idLike...))
+
+	env.Tools = make([]Tool, 0, len(coreTools)+len(extraTools))
+	for _, name := range coreTools {
+		_, err := exec.LookPath(name)
+		env.Tools = append(env.Tools, Tool{Name: name, Present: err == nil, Core: true})
+	}
+	for _, name := range extraTools {
+		_, err := exec.LookPath(name)
+		env.Tools = append(env.Tools, Tool{Name: name, Present: err == nil})
+	}
+
+	var wg sync.WaitGroup
+	for i := range env.Tools {
+		if env.Tools[i].Present && env.Tools[i].Core {
+			wg.Add(1)
+			go func(tool *Tool) {
+				defer wg.Done()
+				tool.Variant = toolVariant(tool.Name)
+			}(&env.Tools[i])
+		}
+	}
+	wg.Wait()
+	return env
+}
+
+// readOSRelease 读取 os-release 文件中的键值
+func readOSRelease() map[string]string {
+	values := make(map[string]string)
+	for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), "=")
+			if ok {
+				values[key] = strings.Trim(value, `"'`)
+			}
+		}
+		f.Close()
+		break
+	}
+	return values
+}
+
+// findPackageManager 按发行版查找已安装的包管理器，发行版未知时依次尝试常见的包管理器
+func findPackageManager(ids []string) string {
+	for _, id := range ids {
+		for _, name := range packageManagers[id] {
+			if _, err := exec.LookPath(name); err == nil {
+				return name
+			}
+		}
+	}
+	for _, name := range fallbackPackageManagers {
+		if _, err := exec.LookPath(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// toolVariant 根据 --version 的输出判断工具的实现。BSD 版本的工具通常不支持 --version，
+// 只会打印用法说明，因此在 Linux 以外的系统上无法识别的都按 BSD 处理
+func toolVariant(name string) string {
+	out := commandOutput(name, "--version")
+	if name == "awk" && strings.Contains(out, "not an option") {
+		// mawk 只认 -W version
+		out = commandOutput(name, "-W", "version")
+	}
+	switch {
+	case strings.Contains(out, "BusyBox"):
+		return "BusyBox"
+	case strings.Contains(out, "GNU"), strings.Contains(out, "Free Software Foundation"):
+		return "GNU"
+	case strings.Contains(out, "mawk"):
+		return "mawk"
+	case strings.Contains(strings.ToLower(out), "bsd"), runtime.GOOS != "linux":
+		return "BSD"
+	}
+	return ""
+}
+
+// commandOutput 运行一个探测命令并返回去掉首尾空白的输出（含标准错误），失败时返回空字符串
+func commandOutput(name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := cmd.CombinedOutput()
+	if err != nil && len(out) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Description 返回系统的一行描述，如 "Ubuntu 22.04.4 LTS (linux/amd64)"
+func (e Environment) Description() string {
+	platform := e.OS + "/" + e.Arch
+	if e.Distro == "" {
+		return platform
+	}
+	return e.Distro + " (" + platform + ")"
+}
+
+// ToolSummary 返回常用工具的一行描述，如 "grep (GNU), sed (GNU); installed: rg, jq; not installed: fd"
+func (e Environment) ToolSummary() string {
+	var core, installed, missing []string
+	for _, tool := range e.Tools {
+		switch {
+		case tool.Core && tool.Present && tool.Variant != "":
+			core = append(core, tool.Name+" ("+tool.Variant+")")
+		case tool.Core:
+			// 核心工具无法判断实现或未安装时不写入，避免误导
+		case tool.Present:
+			installed = append(installed, tool.Name)
+		default:
+			missing = append(missing, tool.Name)
+		}
+	}
+
+	var parts []string
+	if len(core) > 0 {
+		parts = append(parts, strings.Join(core, ", "))
+	}
+	if len(installed) > 0 {
+		parts = append(parts, "installed: "+strings.Join(installed, ", "))
+	}
+	if len(missing) > 0 {
+		parts = append(parts, "not installed: "+strings.Join(missing, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
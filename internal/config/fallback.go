@@ -0,0 +1,56 @@
+package config
+
+import (
+	"strings"
+)
+
+// defaultFallback 是未设置 XSH_FALLBACK 时的回退链：网络不可用或超时后使用离线知识库
+const defaultFallback = "offline@network|timeout"
+
+// FallbackLink 是回退链中的一环：当前一次尝试失败且错误类型匹配 On 时，改用该模型重试
+type FallbackLink struct {
+	ModelRef
+	On []string // 触发条件，如 "timeout"、"rate_limit"、"auth"、"model_not_found"；为空或 "any" 表示任意错误
+}
+
+// Matches 判断某类错误是否会触发这一环
+func (l FallbackLink) Matches(kind string) bool {
+	if len(l.On) == 0 {
+		return true
+	}
+	for _, on := range l.On {
+		if on == "any" || on == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFallbackChain 解析 XSH_FALLBACK，格式为以逗号分隔的 name[:model][@cond|cond...]，例如
+//
+//	openai:gpt-4o-mini@rate_limit|timeout, claude@any, ollama:llama3.2@network
+func ParseFallbackChain(value string) []FallbackLink {
+	var chain []FallbackLink
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		var link FallbackLink
+		if at := strings.Index(entry, "@"); at != -1 {
+			for _, cond := range strings.Split(entry[at+1:], "|") {
+				if cond = strings.TrimSpace(cond); cond != "" {
+					link.On = append(link.On, cond)
+				}
+			}
+			entry = entry[:at]
+		}
+
+		link.ModelRef = parseModelRef(entry)
+		if link.Name != "" {
+			chain = append(chain, link)
+		}
+	}
+	return chain
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed prompts/default.tmpl
+var defaultPromptTemplate string
+
+const (
+	// promptFileName 是配置目录中的全局提示模板
+	promptFileName = "prompt.tmpl"
+	// dirPromptFileName 是按目录生效的提示模板，只读取 TrustedDirs 中的当前目录及其上级目录，
+	// 到仓库根目录为止
+	dirPromptFileName = ".xsh-prompt.tmpl"
+)
+
+// PromptData 是渲染系统提示模板时可用的变量
+type PromptData struct {
+	Environment // 系统、发行版、包管理器和常用工具，如 {{.Distro}}、{{.PackageManager}}、{{.ToolSummary}}
+	Shell       string
+	Cwd         string // 子 shell 的当前目录
+	User        string
+	Locale      string
+	Model       string
+	Provider    string
+	// Rules 是用户模板中 define 之外的文本（团队规范等），由内置模板附加在提示末尾
+	Rules string
+}
+
+// PromptData 返回为 model 渲染系统提示所用的变量，cwd 为空时使用 xsh 自身的当前目录
+func (c *Config) PromptData(model ModelConfig, cwd string) PromptData {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "zsh"
+	}
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+	return PromptData{
+		Environment: ProbeEnvironment(),
+		Shell:       shell,
+		Cwd:         cwd,
+		User:        currentUser(),
+		Locale:      currentLocale(),
+		Model:       model.Model,
+		Provider:    model.Provider,
+	}
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// currentLocale 按 POSIX 的优先顺序读取语言环境
+func currentLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// PromptFiles 返回对 dir 生效的用户提示模板，按应用顺序排列：先是配置目录中的全局模板，
+// 再从最外层到 dir 本身的目录模板，后面的定义覆盖前面的
+func (c *Config) PromptFiles(dir string) []string {
+	var files []string
+	if c.ConfigDir != "" {
+		if path := filepath.Join(c.ConfigDir, promptFileName); fileExists(path) {
+			files = append(files, path)
+		}
+	}
+	trusted, _ := c.dirPromptFiles(dir)
+	return append(files, trusted...)
+}
+
+// IgnoredPromptFiles 返回 dir 及其上级目录中因为不在 TrustedDirs 中而没有读取的目录模板
+func (c *Config) IgnoredPromptFiles(dir string) []string {
+	_, ignored := c.dirPromptFiles(dir)
+	return ignored
+}
+
+// dirPromptFiles 从 dir 向上查找目录模板，到包含 .git 的仓库根目录或文件系统根目录为止，
+// 按从外到内的顺序分别返回可信目录中的和被忽略的模板。任何目录都可能被克隆或解压到本机，
+// 只有用户在 XSH_TRUSTED_DIRS 中列出的目录才能修改系统提示
+func (c *Config) dirPromptFiles(dir string) (trusted, ignored []string) {
+	if dir == "" {
+		return nil, nil
+	}
+	dir = resolvePath(dir)
+	for {
+		if path := filepath.Join(dir, dirPromptFileName); fileExists(path) {
+			if c.trusted(dir) {
+				trusted = append([]string{path}, trusted...)
+			} else {
+				ignored = append([]string{path}, ignored...)
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || exists(filepath.Join(dir, ".git")) {
+			break
+		}
+		dir = parent
+	}
+	return trusted, ignored
+}
+
+// trusted 判断 dir 是否是 TrustedDirs 中的目录或其子目录
+func (c *Config) trusted(dir string) bool {
+	for _, root := range c.TrustedDirs {
+		if rel, err := filepath.Rel(root, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
+// trustedDirs 解析以冒号分隔的 XSH_TRUSTED_DIRS，~ 表示家目录
+func trustedDirs(value string) []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(value) {
+		if rest, ok := strings.CutPrefix(dir, "~"); ok && (rest == "" || rest[0] == '/') {
+			if home, err := os.UserHomeDir(); err == nil {
+				dir = home + rest
+			}
+		}
+		if dir == "" || !filepath.IsAbs(dir) {
+			continue
+		}
+		dirs = append(dirs, resolvePath(dir))
+	}
+	return dirs
+}
+
+// resolvePath 返回 path 解析符号链接后的绝对路径，无法解析时返回清理后的 path
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// SystemPrompt 渲染系统提示；structured 为 true 时使用结构化输出模式的模板。
+// 用户模板可以用 {{define "system"}} 等重新定义内置模板，define 之外的文本作为团队规范附加在提示末尾
+func (c *Config) SystemPrompt(data PromptData, structured bool) (string, error) {
+	set, err := template.New("default").Parse(defaultPromptTemplate)
+	if err != nil {
+		return "", fmt.Errorf("built-in prompt template: %w", err)
+	}
+
+	var rules []string
+	for _, path := range c.PromptFiles(data.Cwd) {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("prompt template: %w", err)
+		}
+		// text/template 的错误信息中已经包含文件名和行号
+		tmpl, err := set.New(path).Parse(string(text))
+		if err != nil {
+			return "", err
+		}
+		if tmpl.Tree == nil || strings.TrimSpace(tmpl.Tree.Root.String()) == "" {
+			continue
+		}
+
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return "", err
+		}
+		if rule := strings.TrimSpace(b.String()); rule != "" {
+			rules = append(rules, rule)
+		}
+	}
+	data.Rules = strings.Join(rules, "\n")
+
+	name := "system"
+	if structured {
+		name = "structured"
+	}
+	var b strings.Builder
+	if err := set.ExecuteTemplate(&b, name, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
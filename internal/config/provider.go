@@ -0,0 +1,128 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"sync"
+)
+
+// ProviderSchema 描述一个提供商如何从环境变量加载 ModelConfig
+type ProviderSchema struct {
+	Name           string // 提供商名称，如 "anthropic"，由注册方填写
+	Key            string // 模型键名，如 "claude"，也是 XSH_MODEL 的取值
+	Priority       int    // 未指定 XSH_MODEL 时的默认选择顺序，数值越小越优先
+	APIKeyEnv      string // API 密钥环境变量，设置后启用该提供商
+	BaseURLEnv     string
+	DefaultBaseURL string
+	ModelEnv       string
+	DefaultModel   string
+	// EnableEnv 中任一变量被设置时，即使没有 API 密钥也启用该提供商（用于本地服务）
+	EnableEnv []string
+	// DisableEnv 非空表示该提供商无需任何设置即默认启用，该变量为 0/false/off 时禁用
+	DisableEnv string
+	// RequiredEnv 中的变量必须全部设置才会启用该提供商（如 Azure 的服务地址和部署名称）
+	RequiredEnv []string
+	// Options 是提供商特有的设置，加载后保存在 ModelConfig.Options 中
+	Options []ProviderOption
+	// NormalizeBaseURL 可选，用于规范化用户填写的服务地址
+	NormalizeBaseURL func(string) string
+}
+
+// ProviderOption 描述一个提供商特有的设置项
+type ProviderOption struct {
+	Name    string // ModelConfig.Options 中的键名，如 "api-version"
+	Env     string
+	Default string
+}
+
+var (
+	schemasMu sync.RWMutex
+	schemas   []ProviderSchema
+)
+
+// RegisterProvider 登记一个提供商的环境变量描述，供 Load 使用
+func RegisterProvider(schema ProviderSchema) {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	schemas = append(schemas, schema)
+}
+
+// registeredSchemas 按优先级返回所有已登记的提供商描述
+func registeredSchemas() []ProviderSchema {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+
+	sorted := append([]ProviderSchema(nil), schemas...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+	return sorted
+}
+
+// ProviderEnvVars 返回启用各提供商所需的环境变量，用于错误提示
+func ProviderEnvVars() []string {
+	var vars []string
+	for _, schema := range registeredSchemas() {
+		if schema.APIKeyEnv != "" {
+			vars = append(vars, schema.APIKeyEnv)
+		} else if len(schema.EnableEnv) > 0 {
+			vars = append(vars, schema.EnableEnv[0])
+		}
+	}
+	return vars
+}
+
+// load 从环境变量读取该提供商的配置，未启用时返回 false
+func (s ProviderSchema) load() (ModelConfig, bool) {
+	var apiKey string
+	if s.APIKeyEnv != "" {
+		apiKey = os.Getenv(s.APIKeyEnv)
+	}
+
+	enabled := apiKey != ""
+	if s.DisableEnv != "" {
+		enabled = getEnvBool(s.DisableEnv, true)
+	}
+	for _, name := range s.EnableEnv {
+		if os.Getenv(name) != "" {
+			enabled = true
+		}
+	}
+	if !enabled {
+		return ModelConfig{}, false
+	}
+	for _, name := range s.RequiredEnv {
+		if os.Getenv(name) == "" {
+			return ModelConfig{}, false
+		}
+	}
+
+	baseURL := s.DefaultBaseURL
+	if s.BaseURLEnv != "" {
+		baseURL = getEnv(s.BaseURLEnv, s.DefaultBaseURL)
+	}
+	if s.NormalizeBaseURL != nil {
+		baseURL = s.NormalizeBaseURL(baseURL)
+	}
+
+	model := s.DefaultModel
+	if s.ModelEnv != "" {
+		model = getEnv(s.ModelEnv, s.DefaultModel)
+	}
+
+	var options map[string]string
+	if len(s.Options) > 0 {
+		options = make(map[string]string, len(s.Options))
+		for _, option := range s.Options {
+			options[option.Name] = getEnv(option.Env, option.Default)
+		}
+	}
+
+	return ModelConfig{
+		Provider: s.Name,
+		APIKey:   apiKey,
+		BaseURL:  baseURL,
+		Model:    model,
+		Options:  options,
+	}, true
+}
@@ -0,0 +1,284 @@
+package kb
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// docTimeout 是读取一个程序的手册页或 --help 输出的时间上限
+	docTimeout = 2 * time.Second
+	// waitDelay 是取消后等待子进程关闭输出的时间，避免仍在运行的孙进程拖住取消
+	waitDelay = 100 * time.Millisecond
+)
+
+// helpAllowed 是没有手册页时可以运行 --help 读取帮助的程序。这些程序常常不附带手册页，
+// 且 --help 只打印帮助；其他程序只读取手册页，不会因为名字出现在问题里就被执行
+var helpAllowed = map[string]bool{
+	"kubectl": true, "helm": true, "docker": true, "podman": true, "terraform": true, "gh": true,
+	"go": true, "cargo": true, "rustup": true, "npm": true, "pnpm": true, "yarn": true, "pip": true, "pip3": true,
+	"rg": true, "fd": true, "jq": true, "yq": true, "aws": true, "gcloud": true, "az": true,
+	"ffmpeg": true, "ffprobe": true,
+}
+
+// docNamePattern 匹配可以查询文档的程序名，排除路径和以 - 开头、会被 man 当作选项的名字
+var docNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.+-]*$`)
+
+// Doc 是一个程序在本机上的文档（手册页或 --help 输出）
+type Doc struct {
+	Program string
+	Source  string // "man" 或 "help"
+	Text    string
+}
+
+var (
+	docsMu   sync.Mutex
+	manDocs  = make(map[string]*Doc) // 缓存手册页的查询结果，nil 表示没有手册页
+	helpDocs = make(map[string]*Doc) // 缓存 --help 的查询结果
+)
+
+// LookupDoc 返回本机安装的 program 的文档：优先读取手册页，没有时对 helpAllowed 中的程序读取 --help 输出。
+// program 应来自用户的问题，不要传入模型回答中的程序名。结果在进程内缓存，取消 ctx 会中止读取
+func LookupDoc(ctx context.Context, program string) (*Doc, bool) {
+	if doc, ok := lookupMan(ctx, program); ok {
+		return doc, true
+	}
+	if !helpAllowed[program] {
+		return nil, false
+	}
+	return lookup(ctx, helpDocs, program, func(ctx context.Context) *Doc {
+		if _, err := exec.LookPath(program); err != nil {
+			return nil
+		}
+		if text := readHelp(ctx, program); text != "" {
+			return &Doc{Program: program, Source: "help", Text: text}
+		}
+		return nil
+	})
+}
+
+// LookupSubcommandDoc 返回 git log 这类子命令的手册页（git-log），只读取手册页
+func LookupSubcommandDoc(ctx context.Context, program, subcommand string) (*Doc, bool) {
+	return lookupMan(ctx, program+"-"+subcommand)
+}
+
+// lookupMan 返回 name 的手册页，不运行 name 本身
+func lookupMan(ctx context.Context, name string) (*Doc, bool) {
+	if !docNamePattern.MatchString(name) {
+		return nil, false
+	}
+	return lookup(ctx, manDocs, name, func(ctx context.Context) *Doc {
+		if text := readMan(ctx, name); text != "" {
+			return &Doc{Program: name, Source: "man", Text: text}
+		}
+		return nil
+	})
+}
+
+// cachedHelp 返回之前读取过的 program 的 --help 输出，不会运行 program
+func cachedHelp(program string) (*Doc, bool) {
+	docsMu.Lock()
+	defer docsMu.Unlock()
+	doc := helpDocs[program]
+	return doc, doc != nil
+}
+
+// lookup 在 cache 中查找 name，没有时用 load 读取并缓存。ctx 被取消时读取的结果不完整，不写入缓存
+func lookup(ctx context.Context, cache map[string]*Doc, name string, load func(context.Context) *Doc) (*Doc, bool) {
+	docsMu.Lock()
+	doc, ok := cache[name]
+	docsMu.Unlock()
+	if ok {
+		return doc, doc != nil
+	}
+
+	doc = load(ctx)
+	if ctx.Err() != nil {
+		return nil, false
+	}
+	docsMu.Lock()
+	cache[name] = doc
+	docsMu.Unlock()
+	return doc, doc != nil
+}
+
+// overstrikePattern 匹配手册页中用退格实现的粗体和下划线
+var overstrikePattern = regexp.MustCompile(".\b")
+
+// readMan 以纯文本读取手册页，没有手册页时返回空字符串
+func readMan(ctx context.Context, name string) string {
+	if _, err := exec.LookPath("man"); err != nil {
+		return readManFile(name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, docTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "man", name)
+	cmd.Env = append(os.Environ(), "MANPAGER=cat", "PAGER=cat", "MANWIDTH=100", "LC_ALL=C", "GROFF_NO_SGR=1")
+	cmd.WaitDelay = waitDelay
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return overstrikePattern.ReplaceAllString(string(out), "")
+}
+
+// readHelp 读取 program --help 的输出，部分程序把帮助写到标准错误
+func readHelp(ctx context.Context, program string) string {
+	ctx, cancel := context.WithTimeout(ctx, docTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, program, "--help")
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	cmd.WaitDelay = waitDelay
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.Run() // 不少程序打印帮助后以非零状态退出
+	if ctx.Err() != nil || !strings.Contains(out.String(), "-") {
+		return ""
+	}
+	return out.String()
+}
+
+// Excerpt 返回文档中与 query 最相关的部分：开头的用法说明，加上按关键词匹配程度挑选的选项段落，
+// 总长度不超过 limit 字节
+func (d *Doc) Excerpt(query string, limit int) string {
+	paragraphs := splitParagraphs(d.Text, d.Source == "man")
+	if len(paragraphs) == 0 {
+		return ""
+	}
+
+	terms := make(map[string]bool)
+	for _, term := range Tokenize(query) {
+		terms[term] = true
+	}
+
+	type scored struct {
+		index int
+		score int
+	}
+	var candidates []scored
+	for i, paragraph := range paragraphs[1:] {
+		score := 0
+		for _, term := range Tokenize(paragraph) {
+			if terms[term] {
+				score++
+			}
+		}
+		if score > 0 {
+			candidates = append(candidates, scored{index: i + 1, score: score})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	// 第一段（NAME / SYNOPSIS 或 Usage 行）总是保留
+	selected := []int{0}
+	size := len(paragraphs[0])
+	for _, candidate := range candidates {
+		if size+len(paragraphs[candidate.index]) > limit {
+			continue
+		}
+		selected = append(selected, candidate.index)
+		size += len(paragraphs[candidate.index])
+	}
+	sort.Ints(selected)
+
+	parts := make([]string, len(selected))
+	for i, index := range selected {
+		parts[i] = paragraphs[index]
+	}
+	excerpt := strings.Join(parts, "\n")
+	if len(excerpt) > limit {
+		excerpt = excerpt[:limit]
+	}
+	return excerpt
+}
+
+// takesCommand 判断用法说明中是否带有子命令，如 "docker [OPTIONS] COMMAND"、"git <command>"
+func (d *Doc) takesCommand() bool {
+	paragraphs := splitParagraphs(d.Text, d.Source == "man")
+	return len(paragraphs) > 0 && strings.Contains(strings.ToLower(paragraphs[0]), "command")
+}
+
+// maxHeadLines 是文档开头用法说明最多保留的行数
+const maxHeadLines = 12
+
+// splitParagraphs 把文档切分为段落。第一段是用法说明：手册页的 NAME 和 SYNOPSIS，
+// 或 --help 输出开头的 Usage 行；其后的选项说明以 "-x" 开头的行为界
+func splitParagraphs(text string, man bool) []string {
+	lines := strings.Split(text, "\n")
+
+	var head []string
+	i := 0
+	if man {
+		inHead := false
+		for ; i < len(lines); i++ {
+			line := lines[i]
+			if isSectionHeading(line) {
+				heading := strings.TrimSpace(line)
+				if heading != "NAME" && heading != "SYNOPSIS" && len(head) > 0 {
+					break
+				}
+				inHead = true
+			}
+			if inHead && strings.TrimSpace(line) != "" && len(head) < maxHeadLines {
+				head = append(head, line)
+			}
+		}
+	} else {
+		for ; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "" {
+				if len(head) > 0 {
+					break
+				}
+				continue
+			}
+			if len(head) < maxHeadLines {
+				head = append(head, lines[i])
+			}
+		}
+	}
+	if len(head) == 0 {
+		return nil
+	}
+
+	paragraphs := []string{strings.Join(head, "\n")}
+	var current []string
+	flush := func() {
+		if len(current) > 0 {
+			paragraphs = append(paragraphs, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+	for _, line := range lines[i:] {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || isSectionHeading(line):
+			flush()
+		case strings.HasPrefix(trimmed, "-"):
+			flush()
+			current = append(current, line)
+		default:
+			current = append(current, line)
+		}
+	}
+	flush()
+	return paragraphs
+}
+
+// isSectionHeading 判断一行是否是手册页的段落标题，如 "DESCRIPTION"
+func isSectionHeading(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" && line[0] != ' ' && strings.ToUpper(line) == line
+}
@@ -0,0 +1,76 @@
+package kb
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Entry 是知识库中的一条命令示例
+type Entry struct {
+	Program     string // 所属程序，如 "tar"
+	Command     string // 命令示例，占位符已去掉花括号
+	Description string
+	Summary     string // 程序的简介，参与检索但不显示
+	Source      string // "tldr"、"man" 或 "builtin"
+}
+
+var (
+	// placeholderPattern 匹配 tldr 页面中的 {{占位符}}
+	placeholderPattern = regexp.MustCompile(`\{\{(.*?)\}\}`)
+	// optionPattern 匹配新版 tldr 页面中短选项与长选项二选一的写法，如 {{[-c|--create]}}
+	optionPattern = regexp.MustCompile(`\{\{\[([^|\]]*)\|[^\]]*\]\}\}`)
+)
+
+// ParseTLDR 解析一个 tldr 格式的页面：
+//
+//	# tar
+//	> Archiving utility.
+//
+//	- Create an archive from files:
+//	`tar cf {{target.tar}} {{file1}}`
+func ParseTLDR(r io.Reader, source string) []Entry {
+	var (
+		entries     []Entry
+		program     string
+		summary     []string
+		description string
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "# "):
+			program = strings.TrimSpace(line[2:])
+		case strings.HasPrefix(line, "> "):
+			text := strings.TrimSpace(line[2:])
+			// 跳过 "More information: <url>." 之类的链接行
+			if !strings.Contains(text, "://") {
+				summary = append(summary, text)
+			}
+		case strings.HasPrefix(line, "- "):
+			description = strings.TrimSuffix(strings.TrimSpace(line[2:]), ":")
+		case len(line) > 2 && strings.HasPrefix(line, "`") && strings.HasSuffix(line, "`"):
+			if program == "" || description == "" {
+				continue
+			}
+			entries = append(entries, Entry{
+				Program:     program,
+				Command:     expandPlaceholders(line[1 : len(line)-1]),
+				Description: description,
+				Summary:     strings.Join(summary, " "),
+				Source:      source,
+			})
+			description = ""
+		}
+	}
+	return entries
+}
+
+// expandPlaceholders 去掉占位符的花括号，选项二选一时保留短选项
+func expandPlaceholders(command string) string {
+	command = optionPattern.ReplaceAllString(command, "$1")
+	return placeholderPattern.ReplaceAllString(command, "$1")
+}
@@ -0,0 +1,165 @@
+package kb
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/xian/xsh/internal/shellwords"
+)
+
+// Invocation 是命令行中对一个程序的调用及其使用的选项
+type Invocation struct {
+	Program    string
+	Subcommand string // 如 git log 中的 "log"，可能只是普通参数
+	Flags      []string
+}
+
+// opaqueWrappers 是自身选项与被包装命令混在一起的程序，这类调用不做检查
+var opaqueWrappers = map[string]bool{
+	"watch": true, "timeout": true, "stdbuf": true, "parallel": true,
+}
+
+// findActions 之后的参数属于 find 要执行的命令
+var findActions = map[string]bool{"-exec": true, "-execdir": true, "-ok": true, "-okdir": true}
+
+var subcommandPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// ParseInvocations 把一行命令按管道、&&、; 等切分，返回每一段调用的程序和选项
+func ParseInvocations(command string) []Invocation {
+	var invocations []Invocation
+	for _, segment := range shellwords.Split(command) {
+		if invocation, ok := parseSegment(segment.Words); ok {
+			invocations = append(invocations, invocation)
+		}
+	}
+	return invocations
+}
+
+func parseSegment(words []shellwords.Word) (Invocation, bool) {
+	// 包装命令自身的选项（如 sudo -u root）可能被误当作程序的选项，这类调用不做检查
+	words, exact := shellwords.Command(words)
+	if !exact || len(words) == 0 || words[0].Quoted || opaqueWrappers[words[0].Text] {
+		return Invocation{}, false
+	}
+	invocation := Invocation{Program: filepath.Base(words[0].Text)}
+	if len(words) > 1 && !words[1].Quoted && subcommandPattern.MatchString(words[1].Text) {
+		invocation.Subcommand = words[1].Text
+	}
+
+	for _, w := range words[1:] {
+		if w.Quoted || len(w.Text) < 2 || w.Text[0] != '-' {
+			continue
+		}
+		if w.Text == "--" || (invocation.Program == "find" && findActions[w.Text]) {
+			break
+		}
+		// -7、-5M 之类是数值参数而不是选项
+		if w.Text[1] >= '0' && w.Text[1] <= '9' {
+			continue
+		}
+		invocation.Flags = append(invocation.Flags, w.Text)
+	}
+	return invocation, true
+}
+
+// Documents 判断选项 flag 是否在文档中出现。组合的短选项（如 -la）逐个检查；
+// 带值的选项（如 --color=auto、-I/usr/include）只检查选项名
+func (d *Doc) Documents(flag string) bool {
+	if strings.HasPrefix(flag, "--") {
+		name, _, _ := strings.Cut(flag, "=")
+		if containsFlag(d.Text, name) {
+			return true
+		}
+		// --no-foo 常写作 --[no-]foo 或只写 --foo
+		if rest, ok := strings.CutPrefix(name, "--no-"); ok {
+			return containsFlag(d.Text, "--[no-]"+rest) || containsFlag(d.Text, "--"+rest)
+		}
+		return false
+	}
+
+	// find -name 这类单横线长选项
+	if containsFlag(d.Text, flag) {
+		return true
+	}
+	for i, r := range flag[1:] {
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !isLetter {
+			// 之后是选项的值
+			return i > 0
+		}
+		if !containsFlag(d.Text, "-"+string(r)) {
+			return false
+		}
+		if i == 0 && strings.ContainsAny(flag, "=/.:,") {
+			return true
+		}
+	}
+	return true
+}
+
+// containsFlag 判断 text 中是否有作为独立选项出现的 flag
+func containsFlag(text, flag string) bool {
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], flag)
+		if i == -1 {
+			return false
+		}
+		start := offset + i
+		end := start + len(flag)
+		if (start == 0 || strings.ContainsRune(" \t\n,[|(", rune(text[start-1]))) &&
+			(end == len(text) || !isFlagChar(text[end])) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func isFlagChar(c byte) bool {
+	return c == '-' || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// UndocumentedFlags 返回 command 中本机文档没有提到的选项。没有文档的程序不做检查，
+// 子命令有单独手册页时（如 git-log）按子命令的手册页检查。command 通常来自模型的回答，
+// 因此只读取手册页，不运行其中的程序
+func UndocumentedFlags(ctx context.Context, command string) []string {
+	var undocumented []string
+	for _, invocation := range ParseInvocations(command) {
+		if len(invocation.Flags) == 0 {
+			continue
+		}
+		doc, ok := InvocationDoc(ctx, invocation)
+		if !ok {
+			continue
+		}
+		for _, flag := range invocation.Flags {
+			if !doc.Documents(flag) {
+				undocumented = append(undocumented, flag)
+			}
+		}
+	}
+	return undocumented
+}
+
+// InvocationDoc 返回检查一次调用所用的文档：子命令的手册页优先，其次是程序本身的手册页，
+// 或者提问时已经读取过的 --help 输出。docker、kubectl 这类带子命令的程序，顶层文档不包含子命令的选项，
+// 没有子命令手册页时不做检查
+func InvocationDoc(ctx context.Context, invocation Invocation) (*Doc, bool) {
+	if invocation.Subcommand != "" {
+		if doc, ok := LookupSubcommandDoc(ctx, invocation.Program, invocation.Subcommand); ok {
+			return doc, true
+		}
+	}
+	doc, ok := lookupMan(ctx, invocation.Program)
+	if !ok {
+		doc, ok = cachedHelp(invocation.Program)
+	}
+	if !ok {
+		return nil, false
+	}
+	if invocation.Subcommand != "" && doc.takesCommand() {
+		return nil, false
+	}
+	return doc, true
+}
@@ -0,0 +1,167 @@
+package kb
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 参数，取常用的默认值
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Index 是对命令示例的 BM25 倒排索引
+type Index struct {
+	entries  []Entry
+	lengths  []int                // 每条示例的词数
+	postings map[string][]posting // 词 -> 出现该词的示例及词频
+	avgLen   float64
+}
+
+type posting struct {
+	doc  int
+	freq int
+}
+
+// Result 是一条检索结果
+type Result struct {
+	Entry
+	Score float64
+}
+
+// NewIndex 为 entries 建立索引
+func NewIndex(entries []Entry) *Index {
+	idx := &Index{
+		entries:  entries,
+		lengths:  make([]int, len(entries)),
+		postings: make(map[string][]posting),
+	}
+
+	var total int
+	for i, entry := range entries {
+		terms := entryTerms(entry)
+		idx.lengths[i] = len(terms)
+		total += len(terms)
+
+		freqs := make(map[string]int)
+		for _, term := range terms {
+			freqs[term]++
+		}
+		for term, freq := range freqs {
+			idx.postings[term] = append(idx.postings[term], posting{doc: i, freq: freq})
+		}
+	}
+	if len(entries) > 0 {
+		idx.avgLen = float64(total) / float64(len(entries))
+	}
+	return idx
+}
+
+// Len 返回索引中的示例数量
+func (idx *Index) Len() int {
+	return len(idx.entries)
+}
+
+// entryTerms 返回一条示例参与检索的词，程序名权重加倍
+func entryTerms(entry Entry) []string {
+	program := Tokenize(entry.Program)
+	terms := append(program, program...)
+	terms = append(terms, Tokenize(entry.Description)...)
+	terms = append(terms, Tokenize(entry.Summary)...)
+	return append(terms, Tokenize(entry.Command)...)
+}
+
+// Search 返回与 query 最相关的至多 limit 条示例，命令相同的示例只保留得分最高的一条
+func (idx *Index) Search(query string, limit int) []Result {
+	scores := make(map[int]float64)
+	n := float64(len(idx.entries))
+	seen := make(map[string]bool)
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			tf := float64(p.freq)
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(idx.lengths[p.doc])/idx.avgLen)
+			scores[p.doc] += idf * tf * (bm25K1 + 1) / (tf + norm)
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for doc, score := range scores {
+		results = append(results, Result{Entry: idx.entries[doc], Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Command < results[j].Command
+	})
+
+	var top []Result
+	commands := make(map[string]bool)
+	for _, result := range results {
+		if len(top) >= limit {
+			break
+		}
+		if commands[result.Command] {
+			continue
+		}
+		commands[result.Command] = true
+		top = append(top, result)
+	}
+	return top
+}
+
+// stopWords 是检索时忽略的常见英文虚词
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "to": true, "of": true, "in": true, "on": true,
+	"for": true, "and": true, "or": true, "with": true, "from": true, "by": true, "at": true,
+	"is": true, "are": true, "be": true, "it": true, "this": true, "that": true, "as": true,
+	"i": true, "me": true, "my": true, "how": true, "do": true, "can": true, "what": true,
+	"which": true, "into": true, "using": true, "use": true, "given": true, "specific": true,
+}
+
+// Tokenize 把文本切分为小写的检索词，去掉虚词并做简单的词形还原
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := fields[:0]
+	for _, field := range fields {
+		if stopWords[field] {
+			continue
+		}
+		terms = append(terms, stem(field))
+	}
+	return terms
+}
+
+// stem 去掉常见的英文复数和进行时后缀，使 "files" 与 "file"、"listing" 与 "list" 相匹配
+func stem(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case len(word) > 5 && strings.HasSuffix(word, "ing"):
+		return word[:len(word)-3]
+	case len(word) > 4 && (strings.HasSuffix(word, "sses") || strings.HasSuffix(word, "xes") ||
+		strings.HasSuffix(word, "ches") || strings.HasSuffix(word, "shes")):
+		return word[:len(word)-2]
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") &&
+		!strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		return word[:len(word)-1]
+	}
+	return word
+}
@@ -0,0 +1,121 @@
+// Package kb 是离线使用的命令知识库：从 tldr 风格的页面和已安装的手册页建立索引，
+// 按 BM25 为自然语言描述检索命令示例
+package kb
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// builtinPages 是随 xsh 分发的常用命令页面，保证没有安装 tldr 时也能给出建议
+//
+//go:embed pages/*.md
+var builtinPages embed.FS
+
+// Sources 指定建立索引所用的页面目录
+type Sources struct {
+	TLDRDirs []string
+	ManDirs  []string
+}
+
+var (
+	indexMu sync.Mutex
+	indexes = make(map[string]*Index)
+)
+
+// Load 返回 sources 对应的索引，同一组目录在进程内只建立一次
+func Load(sources Sources) *Index {
+	key := strings.Join(sources.TLDRDirs, ":") + "|" + strings.Join(sources.ManDirs, ":")
+
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if idx, ok := indexes[key]; ok {
+		return idx
+	}
+
+	entries := BuiltinEntries()
+	for _, dir := range sources.TLDRDirs {
+		entries = append(entries, TLDREntries(dir)...)
+	}
+	entries = append(entries, ManEntries(sources.ManDirs)...)
+
+	idx := NewIndex(entries)
+	indexes[key] = idx
+	return idx
+}
+
+// BuiltinEntries 返回内置页面中的示例
+func BuiltinEntries() []Entry {
+	var entries []Entry
+	files, _ := fs.Glob(builtinPages, "pages/*.md")
+	for _, name := range files {
+		f, err := builtinPages.Open(name)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, ParseTLDR(f, "builtin")...)
+		f.Close()
+	}
+	return entries
+}
+
+// TLDREntries 读取 dir 下的 tldr 页面。tldr 客户端的缓存按平台分目录（common、linux、osx 等），
+// 只读取通用页面和当前平台的页面；直接放在 dir 下的页面总是读取
+func TLDREntries(dir string) []Entry {
+	platform := runtime.GOOS
+	if platform == "darwin" {
+		platform = "osx"
+	}
+
+	var entries []Entry
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".md") {
+			return nil
+		}
+		parent := filepath.Dir(path)
+		switch filepath.Base(parent) {
+		case "common", platform:
+		default:
+			if parent != filepath.Clean(dir) {
+				return nil
+			}
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+		entries = append(entries, ParseTLDR(f, "tldr")...)
+		return nil
+	})
+	return entries
+}
+
+// DefaultTLDRDirs 返回常见 tldr 客户端存放页面的目录
+func DefaultTLDRDirs() []string {
+	var dirs []string
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs,
+			filepath.Join(home, ".local", "share", "tldr"),
+			filepath.Join(home, ".tldr", "cache"), // tldr (Node.js)
+		)
+	}
+	if cache, err := os.UserCacheDir(); err == nil {
+		dirs = append(dirs,
+			filepath.Join(cache, "tldr"),     // tldr (Python)
+			filepath.Join(cache, "tealdeer"), // tealdeer
+		)
+	}
+	return append(dirs, "/usr/share/tldr", "/usr/local/share/tldr")
+}
+
+// DefaultManDirs 返回常见的手册页目录
+func DefaultManDirs() []string {
+	return []string{"/usr/share/man", "/usr/local/share/man", "/usr/local/man", "/opt/homebrew/share/man"}
+}
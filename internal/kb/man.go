@@ -0,0 +1,132 @@
+package kb
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// manSections 是索引的手册章节：用户命令和系统管理命令
+var manSections = []string{"man1", "man8"}
+
+// manHeadBytes 只读取每个手册页开头的这么多字节，NAME 段总是在最前面
+const manHeadBytes = 8 << 10
+
+// ManEntries 读取 dirs 下已安装手册页的 NAME 段，每个程序生成一条示例
+func ManEntries(dirs []string) []Entry {
+	var entries []Entry
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		for _, section := range manSections {
+			files, err := os.ReadDir(filepath.Join(dir, section))
+			if err != nil {
+				continue
+			}
+			for _, file := range files {
+				if file.IsDir() {
+					continue
+				}
+				entry, ok := readManPage(filepath.Join(dir, section, file.Name()))
+				if !ok || seen[entry.Program] {
+					continue
+				}
+				seen[entry.Program] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
+
+// readManPage 解析一个手册页（可为 gzip 压缩）的 NAME 段
+func readManPage(path string) (Entry, bool) {
+	r, err := openManPage(path)
+	if err != nil {
+		return Entry{}, false
+	}
+	defer r.Close()
+
+	program, description := parseManName(io.LimitReader(r, manHeadBytes))
+	if program == "" || description == "" {
+		return Entry{}, false
+	}
+	return Entry{
+		Program:     program,
+		Command:     program,
+		Description: description,
+		Source:      "man",
+	}, true
+}
+
+// troffEscapePattern 匹配常见的 troff 字体、字号和特殊字符转义，如 \fB、\s-1、\(em、\,
+var troffEscapePattern = regexp.MustCompile(`\\f[A-Z0-9]|\\f\[[^\]]*\]|\\s[+-]?[0-9]|\\\([a-z]{2}|\\\[[a-z]+\]|\\\*\(..|\\\*.|\\[&,/:%|^c]`)
+
+// parseManName 从 man(7) 或 mdoc(7) 格式的源码中提取 NAME 段，返回程序名和简介
+func parseManName(r io.Reader) (program, description string) {
+	var (
+		inName bool
+		lines  []string
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		upper := strings.ToUpper(line)
+		if strings.HasPrefix(upper, ".SH") {
+			if inName {
+				break
+			}
+			inName = strings.Trim(strings.TrimSpace(line[3:]), `"`) == "NAME"
+			continue
+		}
+		if !inName || line == "" || strings.HasPrefix(line, `.\"`) {
+			continue
+		}
+
+		// mdoc 格式：.Nm ls / .Nd list directory contents
+		switch {
+		case strings.HasPrefix(line, ".Nm "):
+			if program == "" {
+				program = strings.TrimSuffix(strings.Fields(line[4:])[0], ",")
+			}
+			continue
+		case strings.HasPrefix(line, ".Nd "):
+			description = line[4:]
+			continue
+		case strings.HasPrefix(line, "."):
+			// 其余宏（如 .B、.PP）只保留参数
+			if fields := strings.SplitN(line, " ", 2); len(fields) == 2 {
+				line = fields[1]
+			} else {
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	if program != "" {
+		return program, cleanTroff(description)
+	}
+
+	// man 格式：ls \- list directory contents
+	name := strings.Join(lines, " ")
+	before, after, ok := strings.Cut(name, `\-`)
+	if !ok {
+		before, after, ok = strings.Cut(name, " - ")
+	}
+	if !ok {
+		return "", ""
+	}
+	names := strings.Split(cleanTroff(before), ",")
+	return strings.TrimSpace(names[0]), cleanTroff(after)
+}
+
+// cleanTroff 去掉 troff 转义和多余空白
+func cleanTroff(s string) string {
+	s = strings.NewReplacer(`\-`, "-", `\ `, " ", `\e`, `\`, `\(aq`, "'", `\(dq`, `"`).Replace(s)
+	s = troffEscapePattern.ReplaceAllString(s, "")
+	return strings.Join(strings.Fields(strings.Trim(s, `"`)), " ")
+}
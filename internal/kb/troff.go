@@ -0,0 +1,202 @@
+package kb
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ManDirs 返回手册页目录：MANPATH 中的目录，空的一项表示默认目录
+func ManDirs() []string {
+	value := os.Getenv("MANPATH")
+	if value == "" {
+		return DefaultManDirs()
+	}
+	var dirs []string
+	for _, dir := range filepath.SplitList(value) {
+		if dir == "" {
+			dirs = append(dirs, DefaultManDirs()...)
+		} else {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// findManPage 在手册页目录中查找 name 的源文件，优先用户命令和系统管理命令章节
+func findManPage(name string) string {
+	if strings.ContainsAny(name, `*?[\/`) {
+		return ""
+	}
+	for _, section := range []string{"man1", "man8", "man*"} {
+		for _, dir := range ManDirs() {
+			matches, _ := filepath.Glob(filepath.Join(dir, section, name+".*"))
+			if len(matches) > 0 {
+				return matches[0]
+			}
+		}
+	}
+	return ""
+}
+
+// openManPage 打开手册页源文件，.gz 文件自动解压
+func openManPage(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// readManFile 在没有安装 man 命令时（如精简的容器）直接读取并渲染手册页源文件
+func readManFile(name string) string {
+	path := findManPage(name)
+	if path == "" {
+		return ""
+	}
+	src, err := readManSource(path)
+	if err != nil {
+		return ""
+	}
+
+	// ".so man1/other.1" 表示该页面是另一页面的别名
+	if target, ok := strings.CutPrefix(strings.TrimSpace(src), ".so "); ok && !strings.Contains(target, "\n") {
+		root := filepath.Dir(filepath.Dir(path))
+		if src, err = readManSource(filepath.Join(root, target)); err != nil {
+			if src, err = readManSource(filepath.Join(root, target) + ".gz"); err != nil {
+				return ""
+			}
+		}
+	}
+	return renderMan(src)
+}
+
+func readManSource(path string) (string, error) {
+	r, err := openManPage(path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	return string(data), err
+}
+
+// alternatingMacros 交替使用两种字体，参数之间不加空格，如 .BR \-\-sort ,
+var alternatingMacros = map[string]bool{
+	".BR": true, ".BI": true, ".IR": true, ".RB": true, ".IB": true, ".RI": true,
+}
+
+// renderMan 把 man(7) / mdoc(7) 源码粗略地渲染为纯文本：段落标题顶格，正文缩进，
+// 每个选项说明另起一段。只用于检索和核对选项，不追求排版准确
+func renderMan(src string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(src, "\n") {
+		if strings.HasPrefix(line, `.\"`) || strings.HasPrefix(line, `'\"`) {
+			continue
+		}
+		if !strings.HasPrefix(line, ".") {
+			if text := cleanTroff(line); text != "" {
+				b.WriteString("       " + text + "\n")
+			}
+			continue
+		}
+
+		macro, rest, _ := strings.Cut(line, " ")
+		args := macroArgs(rest)
+		switch macro {
+		case ".SH", ".Sh":
+			b.WriteString("\n" + strings.ToUpper(cleanTroff(strings.Join(args, " "))) + "\n")
+		case ".SS", ".Ss":
+			b.WriteString("\n   " + cleanTroff(strings.Join(args, " ")) + "\n")
+		case ".TP", ".PP", ".LP", ".P", ".Pp", ".sp":
+			b.WriteString("\n")
+		case ".IP":
+			b.WriteString("\n")
+			if len(args) > 0 {
+				b.WriteString("       " + cleanTroff(args[0]) + "\n")
+			}
+		case ".B", ".I", ".SM", ".SB":
+			b.WriteString("       " + cleanTroff(strings.Join(args, " ")) + "\n")
+		case ".It":
+			b.WriteString("\n       " + mdocText(args) + "\n")
+		default:
+			switch {
+			case alternatingMacros[macro]:
+				b.WriteString("       " + cleanTroff(strings.Join(args, "")) + "\n")
+			case len(macro) == 3 && macro[1] >= 'A' && macro[1] <= 'Z' && macro[2] >= 'a' && macro[2] <= 'z':
+				// 其余 mdoc 宏（.Fl、.Op、.Nm 等）
+				if text := mdocText(append([]string{macro[1:]}, args...)); text != "" {
+					b.WriteString("       " + text + "\n")
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// macroArgs 按 troff 规则切分宏参数，双引号内的空格不分隔
+func macroArgs(rest string) []string {
+	var (
+		args    []string
+		current strings.Builder
+		quoted  bool
+	)
+	for _, r := range rest {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// mdocText 渲染一行 mdoc 宏：Fl 为后一个参数加上 "-"，其余宏名省略
+func mdocText(args []string) string {
+	var words []string
+	flag := false
+	for _, arg := range args {
+		switch {
+		case arg == "Fl":
+			flag = true
+			continue
+		case len(arg) == 2 && arg[0] >= 'A' && arg[0] <= 'Z' && arg[1] >= 'a' && arg[1] <= 'z':
+			if flag {
+				words = append(words, "-")
+				flag = false
+			}
+			continue
+		}
+		if flag {
+			arg = "-" + arg
+			flag = false
+		}
+		words = append(words, cleanTroff(arg))
+	}
+	if flag {
+		words = append(words, "-")
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,305 @@
+// Package redact 在内容发往 AI 提供商之前把其中的密钥替换为占位符，
+// 并在返回的文本中把占位符换回原值
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	// minEntropyLength 是熵检测的最短长度，更短的字符串即使随机也不当作密钥
+	minEntropyLength = 20
+	// minClassSwitches 是相邻字符在大写字母、小写字母、数字之间切换的最低比例。
+	// 随机的 base62 字符串约为 0.6，驼峰命名的标识符通常低于 0.3
+	minClassSwitches = 0.45
+)
+
+var (
+	// placeholderPattern 匹配 Redact 生成的占位符
+	placeholderPattern = regexp.MustCompile(`<SECRET_(\d+)>`)
+	// jsonPlaceholderPattern 还匹配 JSON 中转义为 \u003c、\u003e 的尖括号
+	jsonPlaceholderPattern = regexp.MustCompile(`(?:<|\\u003[cC])SECRET_(\d+)(?:>|\\u003[eE])`)
+	// tokenPattern 切分出用于熵检测的候选字符串（base64、base64url 和十六进制字符）
+	tokenPattern = regexp.MustCompile(`[A-Za-z0-9+/_-]{20,}={0,2}`)
+)
+
+// Redactor 在一个会话内把每个密钥稳定地映射为同一个 <SECRET_n> 占位符，
+// 多轮对话和重新生成时模型看到的占位符保持一致
+type Redactor struct {
+	patterns []*regexp.Regexp
+	entropy  float64 // 熵检测阈值（每字符比特数），0 表示关闭
+
+	mu           sync.Mutex
+	placeholders map[string]string // 密钥 -> 占位符
+	secrets      []string          // 第 n 个占位符对应 secrets[n-1]
+}
+
+// New 创建使用内置规则和 patterns 的 Redactor
+func New(patterns []*regexp.Regexp, entropy float64) *Redactor {
+	return &Redactor{
+		patterns:     append(append([]*regexp.Regexp(nil), builtinPatterns...), patterns...),
+		entropy:      entropy,
+		placeholders: make(map[string]string),
+	}
+}
+
+// span 是 text 中需要替换的一段
+type span struct{ start, end int }
+
+// Redact 把 text 中检测到的密钥替换为占位符
+func (r *Redactor) Redact(text string) string {
+	spans := r.detect(text)
+	if len(spans) == 0 {
+		return text
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		b.WriteString(text[last:s.start])
+		b.WriteString(r.placeholder(text[s.start:s.end]))
+		last = s.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Contains 表示 text 中是否含有本会话中已经替换过的任一密钥，
+// 例如 Restore 换回了占位符的回复
+func (r *Redactor) Contains(text string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range r.secrets {
+		if strings.Contains(text, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholder 返回 secret 的占位符，第一次出现时分配新的编号。调用方需持有 r.mu
+func (r *Redactor) placeholder(secret string) string {
+	if p, ok := r.placeholders[secret]; ok {
+		return p
+	}
+	r.secrets = append(r.secrets, secret)
+	p := fmt.Sprintf("<SECRET_%d>", len(r.secrets))
+	r.placeholders[secret] = p
+	return p
+}
+
+// detect 找出 text 中所有密钥的位置，按位置排序并合并重叠的部分
+func (r *Redactor) detect(text string) []span {
+	var spans []span
+	for _, pattern := range r.patterns {
+		for _, m := range pattern.FindAllStringSubmatchIndex(text, -1) {
+			s := span{m[0], m[1]}
+			if len(m) >= 4 {
+				if m[2] < 0 {
+					continue
+				}
+				s = span{m[2], m[3]}
+			}
+			if s.start < s.end && !isPlaceholder(text[s.start:s.end]) {
+				spans = append(spans, s)
+			}
+		}
+	}
+	if r.entropy > 0 {
+		for _, m := range tokenPattern.FindAllStringIndex(text, -1) {
+			if token := text[m[0]:m[1]]; looksRandom(token, r.entropy) {
+				spans = append(spans, span{m[0], m[1]})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end > spans[j].end
+	})
+	merged := spans[:1]
+	for _, s := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if s.start < last.end {
+			last.end = max(last.end, s.end)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// isPlaceholder 表示 value 是已经替换过的占位符
+func isPlaceholder(value string) bool {
+	m := placeholderPattern.FindStringIndex(value)
+	return m != nil && m[0] == 0 && m[1] == len(value)
+}
+
+// looksRandom 判断 token 是否像随机生成的密钥：足够长，同时包含大写字母、小写字母和数字，
+// 字符类别频繁切换，且香农熵不低于 threshold。要求三类字符同时出现可以排除十六进制哈希、
+// UUID 和大部分路径，切换比例可以排除驼峰命名的标识符
+func looksRandom(token string, threshold float64) bool {
+	if len(token) < minEntropyLength {
+		return false
+	}
+	var upper, lower, digit bool
+	var prev rune
+	switches, pairs := 0, 0
+	for _, c := range token {
+		class := charClass(c)
+		switch class {
+		case 'A':
+			upper = true
+		case 'a':
+			lower = true
+		case '0':
+			digit = true
+		default:
+			continue // 分隔符不计入切换
+		}
+		if prev != 0 {
+			pairs++
+			if class != prev {
+				switches++
+			}
+		}
+		prev = class
+	}
+	if !upper || !lower || !digit || float64(switches) < minClassSwitches*float64(pairs) {
+		return false
+	}
+	return shannonEntropy(token) >= threshold
+}
+
+// charClass 返回字符的类别：'A' 大写字母、'a' 小写字母、'0' 数字，其他字符为 0
+func charClass(c rune) rune {
+	switch {
+	case unicode.IsUpper(c):
+		return 'A'
+	case unicode.IsLower(c):
+		return 'a'
+	case unicode.IsDigit(c):
+		return '0'
+	}
+	return 0
+}
+
+// shannonEntropy 计算 s 中每个字符的平均信息量（比特）
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, c := range s {
+		counts[c]++
+	}
+	n := float64(len(s))
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// Restore 把 text 中的占位符换回原来的密钥
+func (r *Redactor) Restore(text string) string {
+	return r.restore(text, placeholderPattern, func(secret string) string { return secret })
+}
+
+// RestoreJSON 与 Restore 相同，但按 JSON 字符串转义密钥，用于结构化输出的原始 JSON 文本
+func (r *Redactor) RestoreJSON(text string) string {
+	return r.restore(text, jsonPlaceholderPattern, func(secret string) string {
+		quoted, _ := json.Marshal(secret)
+		return string(quoted[1 : len(quoted)-1])
+	})
+}
+
+func (r *Redactor) restore(text string, pattern *regexp.Regexp, encode func(string) string) string {
+	if !strings.Contains(text, "SECRET_") {
+		return text
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return pattern.ReplaceAllStringFunc(text, func(p string) string {
+		n, err := strconv.Atoi(pattern.FindStringSubmatch(p)[1])
+		if err != nil || n < 1 || n > len(r.secrets) {
+			return p // 模型编造的占位符保持原样
+		}
+		return encode(r.secrets[n-1])
+	})
+}
+
+// StreamRestorer 返回逐段接收流式文本的 write 函数和流结束时调用的 flush 函数：write 用 restore
+// 换回每段中的占位符后交给 emit。被切分在两段之间的占位符（包括 JSON 中转义为 \u003cSECRET_n\u003e 的形式）
+// 会先保留，等完整到达后再一起输出；flush 输出流结束时仍保留着的文本
+func StreamRestorer(restore func(string) string, emit func(string)) (write func(string), flush func()) {
+	var pending string
+	write = func(chunk string) {
+		text := pending + chunk
+		pending = ""
+		if i := partialStart(text); i != -1 {
+			text, pending = text[:i], text[i:]
+		}
+		if text != "" {
+			emit(restore(text))
+		}
+	}
+	flush = func() {
+		if pending != "" {
+			emit(restore(pending))
+			pending = ""
+		}
+	}
+	return write, flush
+}
+
+// maxPlaceholderLength 是 JSON 转义形式的占位符的最大长度，用于限制向前查找未接收完的占位符的范围
+const maxPlaceholderLength = len(`\u003cSECRET_`) + 20 + len(`\u003e`)
+
+// partialStart 返回 text 末尾未接收完的占位符的起始位置，没有时返回 -1
+func partialStart(text string) int {
+	for i := max(0, len(text)-maxPlaceholderLength); i < len(text); i++ {
+		if (text[i] == '<' || text[i] == '\\') && partialPlaceholder(text[i:]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// partialPlaceholder 表示 s 可能是一个还没有接收完的占位符，开头和结尾的尖括号可以是 JSON 转义形式
+func partialPlaceholder(s string) bool {
+	for _, open := range []string{"<SECRET_", `\u003cSECRET_`, `\u003CSECRET_`} {
+		if len(s) <= len(open) {
+			if strings.HasPrefix(open, s) {
+				return true
+			}
+			continue
+		}
+		if !strings.HasPrefix(s, open) {
+			continue
+		}
+		rest := s[len(open):]
+		digits := len(rest) - len(strings.TrimLeft(rest, "0123456789"))
+		if digits == len(rest) {
+			return true
+		}
+		// 编号之后可能是还没有接收完的 \u003e
+		closing := rest[digits:]
+		return digits > 0 && len(closing) < len(`\u003e`) && strings.HasPrefix(`\u003e`, closing)
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+// Package risk 识别命令中具有破坏性的操作，如删除大范围的目录、直接写入磁盘设备、
+// 执行从网络下载的脚本等
+package risk
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/xian/xsh/internal/shellwords"
+)
+
+var (
+	// devicePattern 匹配磁盘和分区设备
+	devicePattern = regexp.MustCompile(`^/dev/(?:sd[a-z]|hd[a-z]|vd[a-z]|xvd[a-z]|nvme\d|mmcblk\d|r?disk\d|md\d|dm-\d|mapper/|loop\d)`)
+	// remoteScriptPattern 匹配 bash <(curl ...) 和 sh -c "$(curl ...)" 形式的远程脚本执行
+	remoteScriptPattern = regexp.MustCompile(`(?:^|[\s;&|(])(?:ba|z|da|k)?sh\s+(?:-\w+\s+)*(?:<\(|["']?\$\()\s*(?:curl|wget)\b`)
+	// destructiveSQLPattern 匹配删除表或库、清空表，以及没有 WHERE 条件的 DELETE
+	destructiveSQLPattern = regexp.MustCompile(`(?i)\b(?:DROP\s+(?:TABLE|DATABASE|SCHEMA|KEYSPACE)|TRUNCATE\s+(?:TABLE\s+)?\w|DELETE\s+FROM\s+[\w."]+\s*(?:;|["']|$))`)
+)
+
+// interpreters 是从管道读取脚本并执行的程序
+var interpreters = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "fish": true,
+	"python": true, "python3": true, "perl": true, "ruby": true, "node": true,
+}
+
+// sqlClients 是可以直接执行 SQL 语句的命令行客户端
+var sqlClients = map[string]bool{
+	"mysql": true, "mariadb": true, "psql": true, "sqlite3": true, "sqlcmd": true, "duckdb": true,
+	"clickhouse-client": true, "clickhouse": true, "cqlsh": true, "mongo": true, "mongosh": true,
+}
+
+// Assess 返回命令中危险操作的说明，没有发现时返回 nil
+func Assess(command string) []string {
+	var risks []string
+	add := func(reason string) {
+		for _, r := range risks {
+			if r == reason {
+				return
+			}
+		}
+		risks = append(risks, reason)
+	}
+
+	downloading := false // 当前管道中是否有下载命令
+	sqlClient := false
+	for _, seg := range shellwords.Split(command) {
+		if !seg.Piped {
+			downloading = false
+		}
+		words := shellwords.Texts(seg.Words)
+		for _, target := range redirectTargets(words) {
+			if devicePattern.MatchString(target) {
+				add("overwrites device " + target)
+			}
+		}
+
+		name, args := program(seg.Words)
+		switch name {
+		case "rm":
+			checkRemove(args, add)
+		case "dd":
+			for _, arg := range args {
+				if target, ok := strings.CutPrefix(arg, "of="); ok && devicePattern.MatchString(target) {
+					add("writes directly to device " + target)
+				}
+			}
+		case "mkfs", "mke2fs", "mkswap", "wipefs":
+			add("erases " + describeDevices(args, "a filesystem"))
+		case "chmod":
+			checkChmod(args, add)
+		case "chown", "chgrp":
+			if recursive(args, 'R') {
+				for _, path := range operands(args) {
+					if broadPath(path) {
+						add("recursively changes ownership of " + path)
+					}
+				}
+			}
+		case "git":
+			checkGit(args, add)
+		case "curl", "wget", "fetch":
+			downloading = true
+		case "dropdb":
+			add("drops a database")
+		case "mysqladmin":
+			for _, arg := range args {
+				if arg == "drop" {
+					add("drops a database")
+				}
+			}
+		}
+		if strings.HasPrefix(name, "mkfs.") {
+			add("erases " + describeDevices(args, "a filesystem"))
+		}
+		if seg.Piped && downloading && interpreters[name] {
+			add("runs a script downloaded from the network")
+		}
+		if sqlClients[name] {
+			sqlClient = true
+		}
+	}
+
+	if remoteScriptPattern.MatchString(command) {
+		add("runs a script downloaded from the network")
+	}
+	// SQL 可能在客户端的参数中，也可能由 echo 等通过管道传入
+	if sqlClient && destructiveSQLPattern.MatchString(command) {
+		add("drops, truncates or empties database tables")
+	}
+	return risks
+}
+
+// checkRemove 检查递归删除根目录、家目录、当前目录等大范围路径
+func checkRemove(args []string, add func(string)) {
+	if !recursive(args, 'r', 'R') {
+		return
+	}
+	for _, arg := range args {
+		if arg == "--no-preserve-root" {
+			add("recursive delete without root protection")
+		}
+	}
+	for _, path := range operands(args) {
+		if broadPath(path) {
+			add("recursive delete of " + path)
+		}
+	}
+}
+
+// checkChmod 检查递归地把文件设为所有人可写
+func checkChmod(args []string, add func(string)) {
+	if !recursive(args, 'R') {
+		return
+	}
+	for _, arg := range operands(args) {
+		mode := strings.TrimPrefix(arg, "0")
+		if mode == "777" || mode == "666" || strings.Contains(arg, "o+w") || strings.Contains(arg, "a+w") ||
+			strings.Contains(arg, "a+rwx") || strings.Contains(arg, "ugo+rwx") {
+			add("makes files world-writable recursively (chmod " + arg + ")")
+			return
+		}
+	}
+}
+
+// checkGit 检查强制推送
+func checkGit(args []string, add func(string)) {
+	// 跳过 -C dir、-c key=value 等全局选项
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if args[0] == "-C" || args[0] == "-c" {
+			args = args[1:]
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 || args[0] != "push" {
+		return
+	}
+	for _, arg := range args[1:] {
+		if arg == "--force" || strings.HasPrefix(arg, "--force-with-lease") || arg == "--mirror" ||
+			(strings.HasPrefix(arg, "+") && len(arg) > 1) ||
+			(len(arg) > 1 && arg[0] == '-' && arg[1] != '-' && strings.ContainsRune(arg, 'f')) {
+			add("force-pushes and can overwrite remote history")
+			return
+		}
+	}
+}
+
+// program 跳过环境变量赋值和 sudo 等包装命令，返回实际执行的程序名和参数
+func program(words []shellwords.Word) (string, []string) {
+	command, _ := shellwords.Command(words)
+	if len(command) == 0 {
+		return "", nil
+	}
+	return filepath.Base(command[0].Text), shellwords.Texts(command[1:])
+}
+
+// recursive 判断参数中是否有递归选项：--recursive，或包含 letters 中任一字母的短选项组合（如 -rf）
+func recursive(args []string, letters ...rune) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--recursive" {
+			return true
+		}
+		if len(arg) > 1 && arg[0] == '-' && arg[1] != '-' {
+			for _, letter := range letters {
+				if strings.ContainsRune(arg[1:], letter) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// operands 返回不是选项的参数
+func operands(args []string) []string {
+	var result []string
+	options := true
+	for _, arg := range args {
+		switch {
+		case options && arg == "--":
+			options = false
+		case options && len(arg) > 1 && arg[0] == '-':
+		default:
+			result = append(result, arg)
+		}
+	}
+	return result
+}
+
+// broadPath 判断 path 是否指向根目录、家目录、当前目录或根目录下的一级目录。
+// 以变量开头的路径（如 $DIR/*）在变量为空时会变成根目录下的路径，同样视为大范围路径
+func broadPath(path string) bool {
+	switch path {
+	case "/", "/*", "~", "~/", "~/*", "*", ".", "./", "./*", "..", "../", "../*",
+		"$HOME", "${HOME}", "$HOME/", "${HOME}/", "$HOME/*", "${HOME}/*":
+		return true
+	}
+	if strings.HasPrefix(path, "$") && strings.Contains(path, "/") {
+		return true
+	}
+	trimmed := strings.TrimRight(strings.TrimSuffix(path, "*"), "/")
+	return strings.HasPrefix(trimmed, "/") && strings.Count(trimmed, "/") == 1
+}
+
+// describeDevices 列出参数中的设备，没有设备时返回 fallback
+func describeDevices(args []string, fallback string) string {
+	var devices []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "/dev/") {
+			devices = append(devices, arg)
+		}
+	}
+	if len(devices) == 0 {
+		return fallback
+	}
+	return strings.Join(devices, ", ")
+}
+
+// redirectTargets 返回输出重定向的目标，如 > /dev/sda 和 2>>log 中的文件
+func redirectTargets(words []string) []string {
+	var targets []string
+	for i, w := range words {
+		op := strings.TrimLeft(w, "0123456789&")
+		if !strings.HasPrefix(op, ">") {
+			continue
+		}
+		target := strings.TrimLeft(op, ">|")
+		if target == "" && i+1 < len(words) {
+			target = words[i+1]
+		}
+		if target != "" {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,50 @@
+package risk
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAssess(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"ls -la", nil},
+		{"rm -rf ./build", nil},
+		{"rm -rf /", []string{"recursive delete of /"}},
+		{"sudo rm -rf /", []string{"recursive delete of /"}},
+		{"sudo -n rm -rf /", []string{"recursive delete of /"}},
+		{"sudo -u root -E rm -rf ~", []string{"recursive delete of ~"}},
+		{"doas -n rm -rf /*", []string{"recursive delete of /*"}},
+		{"env -u HOME rm -rf $HOME", []string{"recursive delete of $HOME"}},
+		{"nice -n 10 rm -r --no-preserve-root /", []string{"recursive delete without root protection", "recursive delete of /"}},
+		{"find / -name x | xargs rm -rf /", []string{"recursive delete of /"}},
+		{"ls | xargs -0 -I {} rm -rf ~", []string{"recursive delete of ~"}},
+		{"rm -rf $DIR/*", []string{"recursive delete of $DIR/*"}},
+		{"sudo dd if=image.iso of=/dev/sdb bs=4M", []string{"writes directly to device /dev/sdb"}},
+		{"cat x > /dev/nvme0n1", []string{"overwrites device /dev/nvme0n1"}},
+		{"echo 1 2>&1 >/dev/null", nil},
+		{"mkfs.ext4 /dev/sda1", []string{"erases /dev/sda1"}},
+		{"chmod -R 777 /", []string{"makes files world-writable recursively (chmod 777)"}},
+		{"chmod 777 file", nil},
+		{"sudo chown -R me /", []string{"recursively changes ownership of /"}},
+		{"git push --force origin main", []string{"force-pushes and can overwrite remote history"}},
+		{"git push -f", []string{"force-pushes and can overwrite remote history"}},
+		{"git -C repo push origin +main", []string{"force-pushes and can overwrite remote history"}},
+		{"git push origin main", nil},
+		{"curl -fsSL https://x.sh | sudo bash", []string{"runs a script downloaded from the network"}},
+		{"curl -s https://x.sh | tee x.sh", nil},
+		{`sh -c "$(curl -fsSL https://x.sh)"`, []string{"runs a script downloaded from the network"}},
+		{"curl -O https://x.sh; bash x.sh", nil},
+		{`psql -c "DROP TABLE users"`, []string{"drops, truncates or empties database tables"}},
+		{`echo "DELETE FROM users;" | mysql app`, []string{"drops, truncates or empties database tables"}},
+		{`psql -c "DELETE FROM users WHERE id = 1"`, nil},
+		{`echo "DROP TABLE users"`, nil},
+	}
+	for _, tt := range tests {
+		if got := Assess(tt.command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Assess(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package shell
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xian/xsh/internal/ai"
+)
+
+const (
+	// maxCapturedBytes bounds the raw output kept for the running command.
+	maxCapturedBytes = 16 << 10
+	// maxOutputLines is how many trailing lines of output are kept per command.
+	maxOutputLines = 40
+	// maxCommandRecords is the size of the ring buffer of finished commands.
+	maxCommandRecords = 50
+	// maxPendingBytes bounds an unterminated OSC sequence held back between
+	// writes; anything longer is not one of our markers.
+	maxPendingBytes = 4 << 10
+)
+
+// commandTracker segments the PTY output stream into commands using the
+// shell integration markers emitted by the init scripts:
+//
+//	OSC 133;A                      prompt start
+//	OSC 133;B                      prompt end, command input start
+//	OSC 133;C;cmdline_url=<cmd>    command output start
+//	OSC 133;D;<exit code>          command finished
+//	OSC 7;file://<host><cwd>       working directory
+//
+// The markers are left in the stream, so terminals with their own shell
+// integration still see them. Finished commands are kept in a bounded ring
+// buffer, most recent last.
+type commandTracker struct {
+	mu      sync.Mutex
+	pending []byte // start of an OSC sequence split across writes
+	cwd     string
+	running bool
+	current ai.CommandResult
+	output  []byte
+
+	records [maxCommandRecords]ai.CommandResult
+	next    int // index of the slot the next record goes into
+	count   int
+}
+
+var oscStart = []byte("\x1b]")
+
+// Write parses PTY output, recording markers and the output of the running
+// command. It never fails, so it can sit behind an io.MultiWriter.
+func (t *commandTracker) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data := p
+	if len(t.pending) > 0 {
+		data = append(t.pending, p...)
+		t.pending = nil
+	}
+	for len(data) > 0 {
+		i := bytes.Index(data, oscStart)
+		if i == -1 {
+			// A trailing ESC may be the first half of an OSC introducer.
+			if data[len(data)-1] == 0x1b {
+				t.capture(data[:len(data)-1])
+				t.pending = []byte{0x1b}
+			} else {
+				t.capture(data)
+			}
+			break
+		}
+		t.capture(data[:i])
+
+		body := data[i+len(oscStart):]
+		end, terminator := oscEnd(body)
+		if end == -1 {
+			if len(data)-i > maxPendingBytes {
+				t.capture(data[i:])
+			} else {
+				t.pending = append([]byte(nil), data[i:]...)
+			}
+			break
+		}
+		next := i + len(oscStart) + end + terminator
+		t.handleOSC(string(body[:end]), data[i:next])
+		data = data[next:]
+	}
+	return len(p), nil
+}
+
+// oscEnd finds the end of an OSC sequence body, terminated by BEL or ST
+// (ESC \). It returns -1 if the terminator has not arrived yet.
+func oscEnd(body []byte) (end, terminator int) {
+	j := bytes.IndexAny(body, "\x07\x1b")
+	switch {
+	case j == -1:
+		return -1, 0
+	case body[j] == 0x07:
+		return j, 1
+	case j+1 == len(body):
+		return -1, 0
+	case body[j+1] == '\\':
+		return j, 2
+	default:
+		// A stray ESC ends the sequence; it starts whatever comes next.
+		return j, 0
+	}
+}
+
+// handleOSC acts on a complete OSC sequence. Sequences other than the shell
+// integration markers are part of the command's output.
+func (t *commandTracker) handleOSC(body string, raw []byte) {
+	code, params, _ := strings.Cut(body, ";")
+	switch code {
+	case "133":
+		kind, args, _ := strings.Cut(params, ";")
+		switch kind {
+		case "C":
+			t.started(args)
+		case "D":
+			exitCode, _ := strconv.Atoi(args)
+			t.finished(exitCode)
+		}
+	case "7":
+		if cwd, ok := parseFileURL(params); ok {
+			t.cwd = cwd
+		}
+	default:
+		t.capture(raw)
+	}
+}
+
+// capture appends output of the running command, keeping only the tail.
+func (t *commandTracker) capture(p []byte) {
+	if !t.running || len(p) == 0 {
+		return
+	}
+	t.output = append(t.output, p...)
+	if len(t.output) > maxCapturedBytes {
+		t.output = append(t.output[:0], t.output[len(t.output)-maxCapturedBytes:]...)
+	}
+}
+
+// started handles the C marker, emitted just before the command runs.
+func (t *commandTracker) started(args string) {
+	command := ""
+	for _, arg := range strings.Split(args, ";") {
+		if value, ok := strings.CutPrefix(arg, "cmdline_url="); ok {
+			if decoded, err := url.PathUnescape(value); err == nil {
+				command = decoded
+			}
+		}
+	}
+	t.running = true
+	t.current = ai.CommandResult{Command: command, Cwd: t.cwd}
+	t.output = t.output[:0]
+}
+
+// finished handles the D marker with the command's exit status. A D marker
+// without a running command (an empty command line) is ignored.
+func (t *commandTracker) finished(exitCode int) {
+	if !t.running {
+		return
+	}
+	t.running = false
+	t.current.ExitCode = exitCode
+	t.current.Output = cleanOutput(t.output)
+
+	t.records[t.next] = t.current
+	t.next = (t.next + 1) % maxCommandRecords
+	if t.count < maxCommandRecords {
+		t.count++
+	}
+}
+
+// recent returns up to n of the most recently finished commands, oldest first.
+func (t *commandTracker) recent(n int) []ai.CommandResult {
+	n = min(n, t.count)
+	records := make([]ai.CommandResult, 0, n)
+	for i := n; i > 0; i-- {
+		records = append(records, t.records[(t.next-i+maxCommandRecords)%maxCommandRecords])
+	}
+	return records
+}
+
+// Last returns the most recently finished command. The fix request arrives
+// over a separate pipe from the PTY output, so it waits up to wait for a
+// command whose D marker has not been read yet.
+func (t *commandTracker) Last(wait time.Duration) (ai.CommandResult, bool) {
+	deadline := time.Now().Add(wait)
+	for {
+		t.mu.Lock()
+		running, last := t.running, t.recent(1)
+		t.mu.Unlock()
+		if !running || time.Now().After(deadline) {
+			if len(last) == 0 {
+				return ai.CommandResult{}, false
+			}
+			return last[0], true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// parseFileURL extracts the path from an OSC 7 file://host/path URL.
+func parseFileURL(value string) (string, bool) {
+	rest, ok := strings.CutPrefix(value, "file://")
+	if !ok {
+		return "", false
+	}
+	i := strings.Index(rest, "/")
+	if i == -1 {
+		return "", false
+	}
+	path, err := url.PathUnescape(rest[i:])
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+var (
+	// escapePattern matches CSI and OSC terminal escape sequences and other
+	// two-byte escapes.
+	escapePattern = regexp.MustCompile(`\x1b\[[0-9;?<=>]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-_]`)
+)
+
+// cleanOutput strips terminal escapes from captured output, resolves
+// carriage-return overwrites (progress bars) and keeps the last lines.
+func cleanOutput(raw []byte) string {
+	text := escapePattern.ReplaceAllString(string(raw), "")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if j := strings.LastIndex(line, "\r"); j != -1 {
+			lines[i] = line[j+1:]
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > maxOutputLines {
+		lines = lines[len(lines)-maxOutputLines:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -1,7 +1,9 @@
 package shell
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -9,6 +11,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -20,6 +23,7 @@ import (
 	"github.com/manifoldco/promptui"
 	"github.com/xian/xsh/internal/ai"
 	"github.com/xian/xsh/internal/config"
+	"github.com/xian/xsh/internal/usage"
 )
 
 type Shell struct {
@@ -35,9 +39,24 @@ type Shell struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 	aiHookActive atomic.Bool
+	// queryCancel is set while an AI request is in flight; handleInput calls
+	// it when the user presses Esc or Ctrl-C.
+	queryCancel atomic.Pointer[context.CancelFunc]
+	// typeahead holds keys typed while an AI request was in flight. They are
+	// replayed to the picker that follows, and any left over go to the shell.
+	typeaheadMu sync.Mutex
+	typeahead   []byte
+	// commands records the commands run in the child shell and their output.
+	commands commandTracker
+	// templates is the list of prompt templates last reported to the user.
+	templates string
 }
 
 func NewShell(cfg *config.Config) (*Shell, error) {
+	if err := ai.ConfigureTransport(cfg.Transport); err != nil {
+		return nil, fmt.Errorf("invalid network settings: %w", err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	shell := &Shell{
 		config: cfg,
@@ -153,9 +172,11 @@ func (s *Shell) Run() error {
 
 	// === Correct Lifecycle Management ===
 	// Goroutine for handling shell output. This is the primary signal for shutdown.
+	// The output is also fed to the command tracker, which splits it into
+	// commands at the shell integration markers.
 	errChan := make(chan error, 1)
 	go func() {
-		_, err := io.Copy(os.Stdout, s.ptmx)
+		_, err := io.Copy(io.MultiWriter(os.Stdout, &s.commands), s.ptmx)
 		errChan <- err
 	}()
 
@@ -171,7 +192,12 @@ func (s *Shell) Run() error {
 	return err
 }
 
+// inputPollInterval is how long handleInput waits for a key before checking
+// again whether it should still be reading.
+const inputPollInterval = 50 * time.Millisecond
+
 func (s *Shell) handleInput() {
+	fd := int(os.Stdin.Fd())
 	buf := make([]byte, 1024)
 	for {
 		select {
@@ -179,15 +205,39 @@ func (s *Shell) handleInput() {
 			return
 		default:
 			// If the AI hook is active, pause input forwarding to avoid race conditions.
-			if s.aiHookActive.Load() {
+			// While a request is in flight keep reading, so it can be aborted.
+			if s.inputPaused() {
 				time.Sleep(10 * time.Millisecond)
 				continue
 			}
 
+			// Wait with a timeout instead of blocking in Read: a Read still
+			// pending when a query finishes would swallow the first key meant
+			// for the picker.
+			ready, err := waitInput(fd, inputPollInterval)
+			if err != nil {
+				return
+			}
+			if !ready || s.inputPaused() {
+				continue
+			}
+
 			n, err := os.Stdin.Read(buf)
 			if err != nil {
 				return // Can happen on exit
 			}
+			if s.aiHookActive.Load() {
+				// Keys typed while waiting for the AI are not meant for the
+				// shell prompt; keep them for the picker.
+				if cancel := s.queryCancel.Load(); cancel != nil && isAbortKey(buf[:n]) {
+					(*cancel)()
+					continue
+				}
+				s.typeaheadMu.Lock()
+				s.typeahead = append(s.typeahead, buf[:n]...)
+				s.typeaheadMu.Unlock()
+				continue
+			}
 			if _, wErr := s.ptmx.Write(buf[:n]); wErr != nil {
 				return // Can happen if PTY is closed
 			}
@@ -195,6 +245,32 @@ func (s *Shell) handleInput() {
 	}
 }
 
+// inputPaused reports whether handleInput should leave stdin alone because
+// promptui is reading it.
+func (s *Shell) inputPaused() bool {
+	return s.aiHookActive.Load() && s.queryCancel.Load() == nil
+}
+
+// takeTypeahead returns and clears the keys typed during the last AI request.
+func (s *Shell) takeTypeahead() []byte {
+	s.typeaheadMu.Lock()
+	defer s.typeaheadMu.Unlock()
+	keys := s.typeahead
+	s.typeahead = nil
+	return keys
+}
+
+// pickerStdin returns the input for a promptui picker: the keys typed ahead
+// during the request, then the terminal. It returns nil, promptui's default,
+// when nothing was typed.
+func (s *Shell) pickerStdin() io.ReadCloser {
+	keys := s.takeTypeahead()
+	if len(keys) == 0 {
+		return nil
+	}
+	return io.NopCloser(io.MultiReader(bytes.NewReader(keys), os.Stdin))
+}
+
 func (s *Shell) createInitScript(shellName, zdotdir, promptPipePath, resultPipePath string) error {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -208,11 +284,11 @@ func (s *Shell) createInitScript(shellName, zdotdir, promptPipePath, resultPipeP
 	case "zsh":
 		scriptPath = filepath.Join(zdotdir, ".zshrc")
 		userRcPath = filepath.Join(homeDir, ".zshrc")
-		hook = fmt.Sprintf(`xsh_ai_widget() { local p_pipe=%q; local r_pipe=%q; local res; echo -n "$BUFFER" > "$p_pipe"; read -r res < "$r_pipe"; if [[ -n "$res" ]]; then BUFFER=$res; CURSOR=${#res}; fi; zle redisplay; }; zle -N xsh_ai_widget; bindkey '^I' xsh_ai_widget`, promptPipePath, resultPipePath)
+		hook = urlencodeFunc + "\n" + fmt.Sprintf(zshHook, promptPipePath, resultPipePath, s.config.Fix.Key, s.config.Fix.Auto)
 	case "bash":
 		scriptPath = filepath.Join(zdotdir, ".bashrc")
 		userRcPath = filepath.Join(homeDir, ".bashrc")
-		hook = `bind -x '"\t": "echo -e \"\n\x1b[31mxsh: Full AI support is only available for zsh.\x1b[0m\""'`
+		hook = urlencodeFunc + "\n" + bashHook
 	default:
 		return nil // No script for unsupported shells
 	}
@@ -231,6 +307,57 @@ fi
 	return os.WriteFile(scriptPath, []byte(scriptContent), 0600)
 }
 
+// urlencodeFunc percent-encodes the characters that would break an OSC
+// sequence. It works in both zsh and bash and leaves the result in $REPLY.
+const urlencodeFunc = `xsh_urlencode() { local s=${1//\%/%25}; s=${s//;/%3B}; s=${s//$'\n'/%0A}; s=${s//$'\e'/%1B}; s=${s//$'\a'/%07}; REPLY=$s; }`
+
+// zshHook binds Tab to the AI widget and the fix key to the fix widget, and
+// installs preexec/precmd hooks that emit the OSC 133 shell integration
+// markers (see commandTracker). Requests to xsh are NUL-separated: mode
+// ("ask", "fix" or "auto"), $PWD and the edit buffer. With automatic fixes
+// enabled, a failed command triggers an "auto" request and the chosen fix is
+// pushed onto the next prompt's buffer.
+const zshHook = `xsh_prompt_pipe=%[1]q
+xsh_result_pipe=%[2]q
+xsh_auto_fix=%[4]t
+xsh_ran=0
+xsh_request() { local res; print -rn -- "$1"$'\0'"$PWD"$'\0'"$2" > "$xsh_prompt_pipe"; read -r res < "$xsh_result_pipe"; REPLY=$res; }
+xsh_ai_widget() { xsh_request ask "$BUFFER"; if [[ -n "$REPLY" ]]; then BUFFER=$REPLY; CURSOR=${#REPLY}; fi; zle redisplay; }
+xsh_fix_widget() { xsh_request fix ""; if [[ -n "$REPLY" ]]; then BUFFER=$REPLY; CURSOR=${#REPLY}; fi; zle redisplay; }
+xsh_preexec() { xsh_ran=1; xsh_urlencode "$1"; print -rn -- $'\e]133;C;cmdline_url='"$REPLY"$'\a'; }
+xsh_precmd() {
+  local code=$?
+  (( xsh_ran )) && print -rn -- $'\e]133;D;'"$code"$'\a'
+  xsh_urlencode "$PWD"
+  print -rn -- $'\e]7;file://'"$HOST$REPLY"$'\a\e]133;A\a'
+  (( xsh_ran )) || return 0
+  xsh_ran=0
+  # Skip commands stopped by a signal, such as Ctrl-C or Ctrl-Z.
+  if [[ $xsh_auto_fix == true ]] && (( code != 0 && code < 128 )); then
+    xsh_request auto ""
+    [[ -n "$REPLY" ]] && print -z -- "$REPLY"
+  fi
+  return 0
+}
+# Runs after prompt themes, which may rebuild PS1 on every prompt.
+xsh_prompt_end() { [[ $PS1 == *$'\e]133;B\a'* ]] || PS1=$PS1$'%%{\e]133;B\a%%}'; }
+autoload -Uz add-zsh-hook
+add-zsh-hook preexec xsh_preexec
+precmd_functions=(xsh_precmd $precmd_functions)
+add-zsh-hook precmd xsh_prompt_end
+zle -N xsh_ai_widget; bindkey '^I' xsh_ai_widget
+zle -N xsh_fix_widget; bindkey %[3]q xsh_fix_widget`
+
+// bashHook emits the same shell integration markers as zshHook, using PS0
+// for the command start and PROMPT_COMMAND for its exit status. The AI
+// widgets need zle, so Tab only prints a notice.
+const bashHook = `xsh_preexec() { local cmd; cmd=$(HISTTIMEFORMAT= history 1); cmd=${cmd#*[0-9]  }; xsh_urlencode "$cmd"; printf '\e]133;C;cmdline_url=%s\a' "$REPLY"; }
+xsh_precmd() { local code=$?; xsh_urlencode "$PWD"; printf '\e]133;D;%s\a\e]7;file://%s%s\a\e]133;A\a' "$code" "$HOSTNAME" "$REPLY"; }
+PROMPT_COMMAND="xsh_precmd${PROMPT_COMMAND:+; $PROMPT_COMMAND}"
+PS0='$(xsh_preexec)'"$PS0"
+PS1="$PS1"'\[\e]133;B\a\]'
+bind -x '"\t": "echo -e \"\n\x1b[31mxsh: Full AI support is only available for zsh.\x1b[0m\""'`
+
 func (s *Shell) commandServer(promptPipePath, resultPipePath string, originalState *term.State) {
 	for {
 		select {
@@ -272,12 +399,33 @@ func (s *Shell) commandServer(promptPipePath, resultPipePath string, originalSta
 func (s *Shell) triggerAIHook(bufferSnapshot []byte, originalState *term.State) string {
 	s.aiHookActive.Store(true)
 	defer s.aiHookActive.Store(false)
+	// Keys typed during a request that no picker consumed go to the shell.
+	defer func() {
+		if keys := s.takeTypeahead(); len(keys) > 0 {
+			s.ptmx.Write(keys)
+		}
+	}()
 
 	// Correctly manage terminal state transitions for promptui
 	term.Restore(int(os.Stdin.Fd()), originalState)
 	defer term.MakeRaw(int(os.Stdin.Fd()))
 
-	userInput := string(bufferSnapshot)
+	// The hook sends the request mode, the shell's working directory and the
+	// edit buffer, separated by NUL bytes.
+	fields := strings.SplitN(string(bufferSnapshot), "\x00", 3)
+	if len(fields) != 3 {
+		return ""
+	}
+	mode, cwd, userInput := fields[0], fields[1], fields[2]
+	s.ai.SetWorkingDir(cwd)
+	s.reportTemplates(cwd)
+
+	switch mode {
+	case "fix":
+		return s.handleFix(false)
+	case "auto":
+		return s.handleFix(true)
+	}
 	if len(userInput) == 0 {
 		s.handleModelSelection()
 		return "" // Model selection does not return a command
@@ -286,8 +434,35 @@ func (s *Shell) triggerAIHook(bufferSnapshot []byte, originalState *term.State)
 	}
 }
 
+// reportTemplates tells the user which prompt templates shape the system
+// prompt in cwd, whenever that set changes, and which directory templates
+// were skipped because their directory is not trusted.
+func (s *Shell) reportTemplates(cwd string) {
+	files := s.config.PromptFiles(cwd)
+	ignored := s.config.IgnoredPromptFiles(cwd)
+	key := strings.Join(files, "\x00") + "\x01" + strings.Join(ignored, "\x00")
+	if key == s.templates {
+		return
+	}
+	s.templates = key
+	if len(files) == 0 && len(ignored) == 0 {
+		return
+	}
+
+	faint := color.New(color.Faint)
+	fmt.Println()
+	for _, path := range files {
+		faint.Println("Using prompt template", path)
+	}
+	for _, path := range ignored {
+		faint.Printf("Ignoring %s (add its directory to XSH_TRUSTED_DIRS to use it)\n", path)
+	}
+}
+
 func (s *Shell) handleModelSelection() {
-	modelInfos := s.ai.GetAvailableModelInfos()
+	ctx, done := s.startQuery()
+	modelInfos := s.ai.GetAvailableModelInfos(ctx)
+	done()
 	if len(modelInfos) == 0 {
 		s.colors.Error.Println("No models available.")
 		return
@@ -295,9 +470,9 @@ func (s *Shell) handleModelSelection() {
 
 	var items []string
 	selectedIndex := 0
-	currentModel := s.ai.GetCurrentModel()
+	currentInfo, _ := s.config.GetCurrentModelInfo()
 	for i, info := range modelInfos {
-		if info.DisplayName == currentModel {
+		if info.DisplayName == currentInfo.DisplayName && info.Provider == currentInfo.Provider {
 			selectedIndex = i
 		}
 		items = append(items, fmt.Sprintf("%s (%s)", info.DisplayName, info.Provider))
@@ -308,6 +483,7 @@ func (s *Shell) handleModelSelection() {
 		Items:     items,
 		CursorPos: selectedIndex,
 		Size:      10,
+		Stdin:     s.pickerStdin(),
 	}
 
 	idx, _, err := prompt.Run()
@@ -324,68 +500,257 @@ func (s *Shell) handleModelSelection() {
 }
 
 func (s *Shell) handleAIAnalysis(userInput string) string {
-	s.colors.Response.Println("\n🤖 Asking AI for:", userInput)
-	response, err := s.ai.Query(userInput)
+	s.colors.Response.Println("\n🤖 Asking AI for:", userInput, color.New(color.Faint).Sprint("(Esc to cancel)"))
+
+	return s.suggestAndPick(func(ctx context.Context, onMessage ai.StreamHandler) (ai.SuggestResponse, error) {
+		return s.ai.Suggest(ctx, userInput, onMessage)
+	})
+}
+
+// handleFix asks the AI to correct the last command run in the shell, using
+// its exit status and output. In auto mode it is triggered by a failed
+// command, so the user is asked first.
+func (s *Shell) handleFix(auto bool) string {
+	last, ok := s.commands.Last(200 * time.Millisecond)
+	if !ok {
+		s.colors.Error.Println("\nNo previous command to fix.")
+		return ""
+	}
+
+	if auto {
+		confirm := promptui.Prompt{
+			Label:     fmt.Sprintf("%s failed with exit code %d. Ask AI for a fix", last.Command, last.ExitCode),
+			IsConfirm: true,
+		}
+		if _, err := confirm.Run(); err != nil {
+			return "" // Declined or cancelled
+		}
+	}
+
+	s.colors.Response.Printf("\n🔧 Asking AI to fix: %s %s\n", last.Command,
+		color.New(color.Faint).Sprintf("(exit %d, Esc to cancel)", last.ExitCode))
+	return s.suggestAndPick(func(ctx context.Context, onMessage ai.StreamHandler) (ai.SuggestResponse, error) {
+		return s.ai.Fix(ctx, last, onMessage)
+	})
+}
+
+// suggestAndPick runs ask and shows the picker, asking again for as long as
+// the user chooses to regenerate. It returns the chosen command, if any.
+func (s *Shell) suggestAndPick(ask func(context.Context, ai.StreamHandler) (ai.SuggestResponse, error)) string {
+	for {
+		response, ok := s.requestSuggestion(ask)
+		if !ok {
+			return ""
+		}
+
+		choice, regenerate := s.pickSuggestion(response)
+		if !regenerate {
+			if choice == nil || !s.confirmRisky(*choice) {
+				return ""
+			}
+			// The selected command is returned to the shell hook for execution.
+			// The promptui library itself shows the final selection, so no extra printing is needed.
+			return choice.Command
+		}
+
+		s.colors.Response.Println("🔄 Regenerating suggestions...")
+		ask = s.ai.Regenerate
+	}
+}
+
+// startQuery returns a context for an AI request that is cancelled when the
+// user presses Esc or Ctrl-C. The caller must call done once the request has
+// finished, before handing the terminal to promptui again.
+func (s *Shell) startQuery() (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancel(s.ctx)
+
+	restore, err := enterQueryMode(int(os.Stdin.Fd()))
 	if err != nil {
+		// Without cbreak mode the keys cannot be seen; the request still
+		// ends at its deadline.
+		restore = func() {}
+	}
+	s.queryCancel.Store(&cancel)
+
+	return ctx, func() {
+		s.queryCancel.Store(nil)
+		cancel()
+		restore()
+	}
+}
+
+// requestSuggestion runs a suggestion request, rendering the user message as
+// it streams in. It reports false when there is nothing to pick from.
+func (s *Shell) requestSuggestion(ask func(context.Context, ai.StreamHandler) (ai.SuggestResponse, error)) (ai.SuggestResponse, bool) {
+	ctx, done := s.startQuery()
+	streamed := false
+	response, err := ask(ctx, func(text string) {
+		if !streamed {
+			s.colors.Prompt.Print("💡 ")
+			streamed = true
+		}
+		s.colors.Prompt.Print(text)
+	})
+	done()
+	if streamed {
+		fmt.Println()
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		s.colors.Error.Println("AI request cancelled.")
+		return response, false
+	case errors.Is(err, context.DeadlineExceeded):
+		s.colors.Error.Printf("AI request timed out after %s.\n", s.config.Timeout)
+		return response, false
+	default:
 		s.colors.Error.Printf("AI error: %v\n", err)
-		return ""
+		return response, false
 	}
 
-	userMessage, suggestions := parseAIResponse(response)
+	for _, answer := range response.Answers {
+		if answer.Err != nil {
+			s.colors.Error.Printf("%s (%s) failed: %v\n", answer.Model, answer.Provider, answer.Err)
+		}
+	}
 
-	if len(suggestions) == 0 {
-		s.colors.Response.Println("AI:", response) // Show raw response if parsing fails
-		return ""
+	if !response.Parsed {
+		s.colors.Response.Println("AI:", response.Text) // Show raw response if parsing fails
+		return response, false
 	}
 
-	if userMessage != "" {
-		s.colors.Prompt.Println("💡", userMessage)
+	// A re-asked answer replaces the message that was streamed for the first one.
+	if message := response.Suggestion.Message; message != "" && (!streamed || response.Reasked) {
+		s.colors.Prompt.Println("💡", message)
 	}
+	return response, true
+}
 
-	items := append([]string{"[ Cancel ]"}, suggestions...)
+// pickSuggestion shows the suggestion picker. It returns the chosen command,
+// nil if the user cancelled, or regenerate=true when the user asked for fresh
+// suggestions.
+func (s *Shell) pickSuggestion(response ai.SuggestResponse) (choice *ai.SuggestedCommand, regenerate bool) {
+	const (
+		cancelIndex     = 0
+		regenerateIndex = 1
+		firstCommand    = 2
+	)
+
+	items := []string{"[ Cancel ]", "[ Regenerate ]"}
+	answered := answeredModels(response)
+	for _, cmd := range response.Suggestion.Commands {
+		items = append(items, formatSuggestion(cmd, answered))
+	}
 
 	prompt := promptui.Select{
-		Label: "Do you want to execute one of these commands?",
+		Label: fmt.Sprintf("Do you want to execute one of these commands? [%s]", answeredBy(response)),
 		Items: items,
 		Size:  10,
+		Stdin: s.pickerStdin(),
 	}
 
 	idx, _, err := prompt.Run()
-	if err != nil || idx == 0 {
-		return "" // User cancelled or chose not to execute
+	if err != nil || idx == cancelIndex {
+		return nil, false // User cancelled or chose not to execute
+	}
+	if idx == regenerateIndex {
+		return nil, true
 	}
+	return &response.Suggestion.Commands[idx-firstCommand], false
+}
 
-	commandToExecute := suggestions[idx-1]
+// confirmRisky asks the user to type "yes" before a command flagged as
+// destructive is inserted into the command line. Commands without risks are
+// confirmed by picking them.
+func (s *Shell) confirmRisky(cmd ai.SuggestedCommand) bool {
+	if len(cmd.Risks) == 0 {
+		return true
+	}
+	s.colors.Error.Println("⛔ This command is potentially destructive:")
+	for _, reason := range cmd.Risks {
+		s.colors.Error.Println("   -", reason)
+	}
 
-	// The selected command is returned to the shell hook for execution.
-	// The promptui library itself shows the final selection, so no extra printing is needed.
-	return commandToExecute
+	prompt := promptui.Prompt{Label: "Type yes to insert it into the command line"}
+	answer, err := prompt.Run()
+	if err != nil || strings.TrimSpace(answer) != "yes" {
+		s.colors.Response.Println("Command discarded.")
+		return false
+	}
+	return true
 }
 
-// parseAIResponse parses the structured response from the AI.
-func parseAIResponse(response string) (userMessage string, commands []string) {
-	const userMsgPrefix = "USER_MESSAGE:"
-	const shellCmdPrefix = "SHELL_COMMANDS:"
-
-	shellCmdStart := strings.Index(response, shellCmdPrefix)
-	if shellCmdStart == -1 {
-		return "", nil // No commands found, parsing failed.
+// formatSuggestion renders a suggested command for the picker, with its
+// description dimmed after it when the model provided one. In consensus mode
+// it also shows how many of the answering models proposed the command.
+// Options that the installed tool's man page or --help output does not
+// mention are flagged in yellow, and destructive commands are shown in red
+// with the reasons.
+func formatSuggestion(cmd ai.SuggestedCommand, answered int) string {
+	line := cmd.Command
+	if len(cmd.Risks) > 0 {
+		line = color.New(color.FgRed, color.Bold).Sprint(cmd.Command)
+	}
+	if len(cmd.ProposedBy) > 0 {
+		agreement := color.New(color.FgMagenta)
+		if len(cmd.ProposedBy) == answered {
+			agreement = color.New(color.FgGreen)
+		}
+		line += agreement.Sprintf("  [%d/%d: %s]", len(cmd.ProposedBy), answered, strings.Join(cmd.ProposedBy, ", "))
+	}
+	if len(cmd.Risks) > 0 {
+		line += color.New(color.FgRed).Sprintf("  ⛔ %s", strings.Join(cmd.Risks, "; "))
+	}
+	if len(cmd.Undocumented) > 0 {
+		line += color.New(color.FgYellow).Sprintf("  ⚠ not in local docs: %s", strings.Join(cmd.Undocumented, " "))
 	}
+	if cmd.Description != "" {
+		line += color.New(color.Faint).Sprint("  # " + cmd.Description)
+	}
+	return line
+}
 
-	userMsgStart := strings.Index(response, userMsgPrefix)
-	if userMsgStart != -1 && userMsgStart < shellCmdStart {
-		userMessage = strings.TrimSpace(response[userMsgStart+len(userMsgPrefix) : shellCmdStart])
+// answeredModels counts the consensus models that answered without error.
+func answeredModels(response ai.SuggestResponse) int {
+	answered := 0
+	for _, answer := range response.Answers {
+		if answer.Err == nil {
+			answered++
+		}
 	}
+	return answered
+}
 
-	cmdBlock := strings.TrimSpace(response[shellCmdStart+len(shellCmdPrefix):])
-	cmdLines := strings.Split(cmdBlock, "\n")
-	for _, cmd := range cmdLines {
-		if trimmed := strings.TrimSpace(cmd); trimmed != "" {
-			commands = append(commands, trimmed)
+// answeredBy describes which model produced a response for the picker label.
+func answeredBy(response ai.SuggestResponse) string {
+	label := fmt.Sprintf("%s (%s)", response.Model, response.Provider)
+	if len(response.Answers) > 0 {
+		label = fmt.Sprintf("consensus of %d/%d models", answeredModels(response), len(response.Answers))
+	}
+	if response.Fallback {
+		label += " via fallback"
+	}
+	if response.Hedged {
+		label += " via hedge"
+	}
+	if response.Cached {
+		label += " ⚡ cached"
+	}
+	if response.Reasked {
+		label += " · re-checked against local docs"
+	}
+	if !response.Usage.IsZero() {
+		label += " · " + formatTokens(response.Usage)
+		if response.Priced {
+			label += " · " + usage.FormatCost(response.Cost)
 		}
 	}
+	return label
+}
 
-	return userMessage, commands
+// formatTokens renders token counts as "812 in / 96 out".
+func formatTokens(tokens usage.Tokens) string {
+	return fmt.Sprintf("%d in / %d out", tokens.Input, tokens.Output)
 }
 
 func (s *Shell) Goodbye() {
@@ -400,4 +765,9 @@ func (s *Shell) Goodbye() {
 ╚═════╝    ╚═╝   ╚══════╝
 `
 	s.colors.Prompt.Println(byeArt)
+
+	if session := s.ai.SessionUsage(); session.Queries > 0 {
+		s.colors.Response.Printf("AI usage this session: %d queries · %s · %s\n",
+			session.Queries, formatTokens(session.Tokens), usage.FormatCost(session.Cost))
+	}
 }
@@ -0,0 +1,65 @@
+package shell
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// enterQueryMode switches the terminal to cbreak mode for the duration of an
+// AI request: keys are delivered one at a time without echo, and Ctrl-C
+// arrives as a byte instead of raising SIGINT, so handleInput can turn Esc or
+// Ctrl-C into a cancellation. Enter is not translated to a newline, so keys
+// typed ahead can be replayed to the picker, which expects a carriage return.
+// Output processing is left on, so messages printed meanwhile still render
+// normally. The returned function restores the previous mode.
+func enterQueryMode(fd int) (restore func(), err error) {
+	old, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := *old
+	mode.Lflag &^= unix.ICANON | unix.ECHO | unix.ISIG
+	mode.Iflag &^= unix.ICRNL
+	mode.Cc[unix.VMIN] = 1
+	mode.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, &mode); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		unix.IoctlSetTermios(fd, ioctlWriteTermios, old)
+	}, nil
+}
+
+// isAbortKey reports whether a read from stdin is a lone Esc or contains
+// Ctrl-C. Escape sequences such as arrow keys arrive in a single read and
+// start with Esc too, so only a read consisting of Esc alone counts.
+func isAbortKey(input []byte) bool {
+	if len(input) == 1 && input[0] == 0x1b {
+		return true
+	}
+	for _, b := range input {
+		if b == 0x03 {
+			return true
+		}
+	}
+	return false
+}
+
+// waitInput waits up to timeout for fd to become readable. Unlike a blocking
+// Read it can be abandoned, so no key is consumed after the caller stops
+// wanting input.
+func waitInput(fd int, timeout time.Duration) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, int(timeout/time.Millisecond))
+	if errors.Is(err, unix.EINTR) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return n > 0 && fds[0].Revents != 0, nil
+}
@@ -0,0 +1,171 @@
+// Package shellwords 按 shell 规则把一行命令切分为简单命令和词，并找出包装命令之后实际执行的程序。
+// 选项核对（kb）和危险操作识别（risk）共用这里的解析
+package shellwords
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Word 是按 shell 规则切分出的一个词，引号和转义已经去掉
+type Word struct {
+	Text   string
+	Quoted bool // 词中有加引号的部分
+}
+
+// Segment 是命令行中的一段简单命令
+type Segment struct {
+	Words []Word
+	Piped bool // 标准输入来自前一段的管道
+}
+
+// assignmentPattern 匹配命令前的环境变量赋值，如 LANG=C
+var assignmentPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// wrappers 是只包装后续命令的程序，判断实际执行的程序时跳过。值是该程序自身带参数值的选项，
+// 如 sudo -u root、nice -n 10；不在其中的选项（如 sudo -n）不带参数值
+var wrappers = map[string]map[string]bool{
+	"sudo":    sudoValueOptions,
+	"doas":    sudoValueOptions,
+	"env":     {"-u": true, "--unset": true, "-C": true, "--chdir": true, "-S": true, "--split-string": true},
+	"nice":    {"-n": true, "--adjustment": true},
+	"time":    {"-f": true, "--format": true, "-o": true, "--output": true},
+	"exec":    {"-a": true},
+	"xargs":   xargsValueOptions,
+	"nohup":   {},
+	"command": {},
+	"builtin": {},
+}
+
+// xargsValueOptions 是 xargs 带参数值的选项
+var xargsValueOptions = map[string]bool{
+	"-a": true, "--arg-file": true, "-d": true, "--delimiter": true, "-E": true, "-I": true, "-L": true,
+	"-n": true, "--max-args": true, "-P": true, "--max-procs": true, "-s": true, "--max-chars": true,
+}
+
+// sudoValueOptions 是 sudo 和 doas 带参数值的选项
+var sudoValueOptions = map[string]bool{
+	"-u": true, "--user": true, "-g": true, "--group": true, "-C": true, "--close-from": true, "-h": true, "--host": true,
+	"-p": true, "--prompt": true, "-D": true, "--chdir": true, "-r": true, "--role": true, "-t": true, "--type": true,
+}
+
+// Split 按 shell 规则切词，并在管道、&&、||、;、&、括号和反引号处分段
+func Split(command string) []Segment {
+	var (
+		segments []Segment
+		words    []Word
+		current  strings.Builder
+		inWord   bool
+		quoted   bool
+		quote    rune
+		escaped  bool
+		piped    bool
+	)
+	endWord := func() {
+		if inWord {
+			words = append(words, Word{Text: current.String(), Quoted: quoted})
+		}
+		current.Reset()
+		inWord, quoted = false, false
+	}
+	endSegment := func(nextPiped bool) {
+		endWord()
+		if len(words) > 0 {
+			segments = append(segments, Segment{Words: words, Piped: piped})
+		}
+		words, piped = nil, nextPiped
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' {
+				escaped = true
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == '\'' || r == '"':
+			quote, inWord, quoted = r, true, true
+		case r == ' ' || r == '\t' || r == '\n':
+			endWord()
+		case r == '|':
+			// 重定向中的 >| 不是管道
+			if inWord && strings.HasSuffix(current.String(), ">") {
+				current.WriteRune(r)
+				continue
+			}
+			if i+1 < len(runes) && runes[i+1] == '|' {
+				i++
+				endSegment(false)
+				continue
+			}
+			// |& 同样是管道
+			if i+1 < len(runes) && runes[i+1] == '&' {
+				i++
+			}
+			endSegment(true)
+		case r == '&':
+			// 2>&1 之类的重定向
+			if inWord && strings.HasSuffix(current.String(), ">") {
+				current.WriteRune(r)
+				continue
+			}
+			endSegment(false)
+		case strings.ContainsRune(";()`", r):
+			endSegment(false)
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	endSegment(false)
+	return segments
+}
+
+// Command 跳过环境变量赋值和 sudo、env 等包装命令，返回实际执行的命令：第一个词是程序，其后是参数。
+// 包装命令带有自身的选项时按常见用法跳过这些选项，此时 exact 为 false，表示结果可能不准确
+func Command(words []Word) (command []Word, exact bool) {
+	exact = true
+	for len(words) > 0 {
+		w := words[0]
+		switch {
+		case assignmentPattern.MatchString(w.Text):
+			words = words[1:]
+		case wrappers[w.Text] != nil:
+			valueOptions := wrappers[w.Text]
+			words = words[1:]
+			for len(words) > 0 && strings.HasPrefix(words[0].Text, "-") {
+				exact = false
+				option := words[0].Text
+				words = words[1:]
+				if option == "--" {
+					break
+				}
+				if valueOptions[option] && len(words) > 0 {
+					words = words[1:]
+				}
+			}
+		default:
+			return words, exact
+		}
+	}
+	return nil, exact
+}
+
+// Texts 返回 words 的文本
+func Texts(words []Word) []string {
+	texts := make([]string, len(words))
+	for i, w := range words {
+		texts[i] = w.Text
+	}
+	return texts
+}
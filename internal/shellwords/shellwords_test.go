@@ -0,0 +1,86 @@
+package shellwords
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []Segment
+	}{
+		{"ls -la", []Segment{{Words: []Word{{Text: "ls"}, {Text: "-la"}}}}},
+		{`grep "a b" 'c'`, []Segment{{Words: []Word{{Text: "grep"}, {Text: "a b", Quoted: true}, {Text: "c", Quoted: true}}}}},
+		{`echo a\ b`, []Segment{{Words: []Word{{Text: "echo"}, {Text: "a b"}}}}},
+		{"curl x | sh", []Segment{
+			{Words: []Word{{Text: "curl"}, {Text: "x"}}},
+			{Words: []Word{{Text: "sh"}}, Piped: true},
+		}},
+		{"make |& tee log", []Segment{
+			{Words: []Word{{Text: "make"}}},
+			{Words: []Word{{Text: "tee"}, {Text: "log"}}, Piped: true},
+		}},
+		{"a && b || c; d & e", []Segment{
+			{Words: []Word{{Text: "a"}}},
+			{Words: []Word{{Text: "b"}}},
+			{Words: []Word{{Text: "c"}}},
+			{Words: []Word{{Text: "d"}}},
+			{Words: []Word{{Text: "e"}}},
+		}},
+		{"ls 2>&1 | less", []Segment{
+			{Words: []Word{{Text: "ls"}, {Text: "2>&1"}}},
+			{Words: []Word{{Text: "less"}}, Piped: true},
+		}},
+		{"echo hi >| out", []Segment{{Words: []Word{{Text: "echo"}, {Text: "hi"}, {Text: ">|"}, {Text: "out"}}}}},
+		{"(cd /tmp; ls)", []Segment{
+			{Words: []Word{{Text: "cd"}, {Text: "/tmp"}}},
+			{Words: []Word{{Text: "ls"}}},
+		}},
+		{"echo `date`", []Segment{
+			{Words: []Word{{Text: "echo"}}},
+			{Words: []Word{{Text: "date"}}},
+		}},
+	}
+	for _, tt := range tests {
+		if got := Split(tt.command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Split(%q) = %+v, want %+v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+		exact   bool
+	}{
+		{"rm -rf /", []string{"rm", "-rf", "/"}, true},
+		{"LANG=C FOO=\"a b\" sort -u", []string{"sort", "-u"}, true},
+		{"sudo rm -rf /", []string{"rm", "-rf", "/"}, true},
+		{"sudo -n rm -rf /", []string{"rm", "-rf", "/"}, false},
+		{"sudo -u root -E rm -rf /", []string{"rm", "-rf", "/"}, false},
+		{"sudo --user root rm -rf /", []string{"rm", "-rf", "/"}, false},
+		{"sudo -- rm -rf /", []string{"rm", "-rf", "/"}, false},
+		{"doas -u root -n rm x", []string{"rm", "x"}, false},
+		{"env -i PATH=/bin rm -rf .", []string{"rm", "-rf", "."}, false},
+		{"env -u HOME -C /tmp ls", []string{"ls"}, false},
+		{"nice -n 10 make", []string{"make"}, false},
+		{"nohup time sudo dd if=x", []string{"dd", "if=x"}, true},
+		{"xargs rm -rf", []string{"rm", "-rf"}, true},
+		{"xargs -0 -I {} rm -rf {}", []string{"rm", "-rf", "{}"}, false},
+		{"sudo", nil, true},
+		{"FOO=1", nil, true},
+	}
+	for _, tt := range tests {
+		segments := Split(tt.command)
+		command, exact := Command(segments[0].Words)
+		var got []string
+		if len(command) > 0 {
+			got = Texts(command)
+		}
+		if !reflect.DeepEqual(got, tt.want) || exact != tt.exact {
+			t.Errorf("Command(%q) = %q, %v; want %q, %v", tt.command, got, exact, tt.want, tt.exact)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package usage
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// WriteReport 输出按日期和按模型汇总的用量表
+func WriteReport(w io.Writer, records []Record) error {
+	if len(records) == 0 {
+		_, err := fmt.Fprintln(w, "No AI usage recorded.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	writeGroups(tw, "Date", GroupBy(records, ByDay))
+	fmt.Fprintln(tw)
+	writeGroups(tw, "Model", GroupBy(records, ByModel))
+	return tw.Flush()
+}
+
+func writeGroups(w io.Writer, title string, groups []Group) {
+	var total Summary
+	fmt.Fprintf(w, "%s\tQueries\tInput\tOutput\tCost\t\n", title)
+	for _, group := range groups {
+		writeSummary(w, group.Key, group.Summary)
+		total.Queries += group.Queries
+		total.Tokens = total.Tokens.Add(group.Tokens)
+		total.Cost += group.Cost
+	}
+	writeSummary(w, "Total", total)
+}
+
+func writeSummary(w io.Writer, key string, summary Summary) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t\n",
+		key, summary.Queries, summary.Tokens.Input, summary.Tokens.Output, FormatCost(summary.Cost))
+}
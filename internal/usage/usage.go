@@ -0,0 +1,238 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tokens 是一次请求消耗的 token 数
+type Tokens struct {
+	Input  int `json:"input_tokens"`
+	Output int `json:"output_tokens"`
+}
+
+// Add 累加 token 数
+func (t Tokens) Add(other Tokens) Tokens {
+	return Tokens{Input: t.Input + other.Input, Output: t.Output + other.Output}
+}
+
+// IsZero 表示提供商没有返回用量信息
+func (t Tokens) IsZero() bool {
+	return t.Input == 0 && t.Output == 0
+}
+
+// Price 是每百万 token 的价格（美元）
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Prices 是按模型名前缀匹配的价格表
+type Prices map[string]Price
+
+// defaultPrices 是常见模型的公开价格，可在 prices.json 中覆盖或补充
+var defaultPrices = Prices{
+	"claude-opus-4":     {Input: 15, Output: 75},
+	"claude-sonnet-4":   {Input: 3, Output: 15},
+	"claude-3-7-sonnet": {Input: 3, Output: 15},
+	"claude-3-5-sonnet": {Input: 3, Output: 15},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4},
+	"claude-3-opus":     {Input: 15, Output: 75},
+	"claude-3-sonnet":   {Input: 3, Output: 15},
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.6},
+	"gpt-4o":            {Input: 2.5, Output: 10},
+	"gpt-4.1-mini":      {Input: 0.4, Output: 1.6},
+	"gpt-4.1":           {Input: 2, Output: 8},
+	"gpt-4-turbo":       {Input: 10, Output: 30},
+	"gpt-4":             {Input: 30, Output: 60},
+	"gpt-3.5-turbo":     {Input: 0.5, Output: 1.5},
+	"gemini-2.0-flash":  {Input: 0.1, Output: 0.4},
+	"gemini-1.5-flash":  {Input: 0.075, Output: 0.3},
+	"gemini-1.5-pro":    {Input: 1.25, Output: 5},
+	"gemini-pro":        {Input: 0.5, Output: 1.5},
+}
+
+// LoadPrices 返回默认价格表，并用 path 指向的 JSON 文件覆盖（文件不存在时忽略），格式为
+//
+//	{"gpt-4o": {"input": 2.5, "output": 10}, "my-gateway-model": {"input": 1, "output": 2}}
+func LoadPrices(path string) (Prices, error) {
+	prices := make(Prices, len(defaultPrices))
+	for model, price := range defaultPrices {
+		prices[model] = price
+	}
+	if path == "" {
+		return prices, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return prices, nil
+	}
+	if err != nil {
+		return prices, fmt.Errorf("failed to read price table: %w", err)
+	}
+
+	var custom Prices
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return prices, fmt.Errorf("failed to parse price table %s: %w", path, err)
+	}
+	for model, price := range custom {
+		prices[model] = price
+	}
+	return prices, nil
+}
+
+// Cost 按最长前缀匹配模型价格并计算费用，价格表中没有该模型时返回 false
+func (p Prices) Cost(model string, tokens Tokens) (float64, bool) {
+	best := ""
+	for prefix := range p {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return 0, false
+	}
+	price := p[best]
+	return (float64(tokens.Input)*price.Input + float64(tokens.Output)*price.Output) / 1e6, true
+}
+
+// Record 是用量日志中的一条记录
+type Record struct {
+	Time     time.Time `json:"time"`
+	Provider string    `json:"provider"`
+	Model    string    `json:"model"`
+	Tokens
+	Cost float64 `json:"cost"`
+	// Failed 表示请求失败或被取消（如对冲请求中落选的一方），回答没有被使用，但提供商报告的用量仍然计费
+	Failed bool `json:"failed,omitempty"`
+}
+
+// Summary 汇总多次请求的用量
+type Summary struct {
+	Queries int
+	Tokens  Tokens
+	Cost    float64
+}
+
+// Add 把一条记录计入汇总，失败的请求只计入用量和费用，不计入查询次数
+func (s *Summary) Add(record Record) {
+	if !record.Failed {
+		s.Queries++
+	}
+	s.Tokens = s.Tokens.Add(record.Tokens)
+	s.Cost += record.Cost
+}
+
+// Log 是追加写入的 JSONL 用量日志
+type Log struct {
+	path string
+}
+
+// NewLog 创建指向 path 的用量日志
+func NewLog(path string) *Log {
+	return &Log{path: path}
+}
+
+// Append 追加一条记录
+func (l *Log) Append(record Record) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return fmt.Errorf("failed to create usage log directory: %w", err)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage record: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open usage log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage log: %w", err)
+	}
+	return nil
+}
+
+// Read 读取 since 之后的所有记录，日志不存在时返回空列表
+func (l *Log) Read(since time.Time) ([]Record, error) {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage log: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue // 跳过损坏的行
+		}
+		if !record.Time.Before(since) {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("failed to read usage log: %w", err)
+	}
+	return records, nil
+}
+
+// Group 是按某个维度分组后的汇总
+type Group struct {
+	Key string
+	Summary
+}
+
+// GroupBy 按 key 函数分组汇总记录，结果按 key 排序
+func GroupBy(records []Record, key func(Record) string) []Group {
+	summaries := make(map[string]*Summary)
+	for _, record := range records {
+		k := key(record)
+		if summaries[k] == nil {
+			summaries[k] = &Summary{}
+		}
+		summaries[k].Add(record)
+	}
+
+	groups := make([]Group, 0, len(summaries))
+	for k, summary := range summaries {
+		groups = append(groups, Group{Key: k, Summary: *summary})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Key < groups[j].Key
+	})
+	return groups
+}
+
+// ByDay 以本地日期分组
+func ByDay(record Record) string {
+	return record.Time.Local().Format("2006-01-02")
+}
+
+// ByModel 以 "模型 (提供商)" 分组
+func ByModel(record Record) string {
+	return fmt.Sprintf("%s (%s)", record.Model, record.Provider)
+}
+
+// FormatCost 格式化费用，小额费用保留更多小数位
+func FormatCost(cost float64) string {
+	if cost > 0 && cost < 0.01 {
+		return fmt.Sprintf("$%.4f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
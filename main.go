@@ -1,14 +1,31 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/xian/xsh/internal/config"
 	"github.com/xian/xsh/internal/shell"
+	"github.com/xian/xsh/internal/usage"
 )
 
 func main() {
+	// usage、prompt 子命令不启动 shell，可以在 xsh 会话内运行
+	if len(os.Args) > 1 && (os.Args[1] == "usage" || os.Args[1] == "prompt") {
+		run := runUsage
+		if os.Args[1] == "prompt" {
+			run = runPrompt
+		}
+		if err := run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if os.Getenv("XSH_SESSION") == "true" {
 		fmt.Fprintln(os.Stderr, "Error: Nested xsh sessions are not supported.")
 		os.Exit(1)
@@ -35,3 +52,61 @@ func main() {
 		}
 	}
 }
+
+// runUsage 输出最近几天的 token 用量和费用
+func runUsage(args []string) error {
+	flags := flag.NewFlagSet("usage", flag.ContinueOnError)
+	days := flags.Int("days", 30, "number of days to include (0 for all)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var since time.Time
+	if *days > 0 {
+		now := time.Now()
+		since = time.Date(now.Year(), now.Month(), now.Day()-*days+1, 0, 0, 0, 0, now.Location())
+	}
+
+	cfg := config.Load()
+	records, err := usage.NewLog(cfg.Usage.LogFile).Read(since)
+	if err != nil {
+		return err
+	}
+	return usage.WriteReport(os.Stdout, records)
+}
+
+// runPrompt 输出在当前目录下实际生效的系统提示，用于检查自定义的提示模板
+func runPrompt(args []string) error {
+	flags := flag.NewFlagSet("prompt", flag.ContinueOnError)
+	structured := flags.Bool("structured", false, "print the prompt used with structured output")
+	model := flags.String("model", "", "render the prompt for this model (default: current model)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := config.Load()
+	modelConfig, ok := cfg.GetCurrentModel()
+	if *model != "" {
+		name, version, _ := strings.Cut(*model, ":")
+		if modelConfig, ok = cfg.ResolveModel(name, version); !ok {
+			return fmt.Errorf("model %s is not available or not configured", *model)
+		}
+	}
+	if !ok {
+		return fmt.Errorf("no AI model configured")
+	}
+
+	data := cfg.PromptData(modelConfig, "")
+	for _, path := range cfg.PromptFiles(data.Cwd) {
+		fmt.Fprintf(os.Stderr, "# template: %s\n", path)
+	}
+	for _, path := range cfg.IgnoredPromptFiles(data.Cwd) {
+		fmt.Fprintf(os.Stderr, "# ignored (not in XSH_TRUSTED_DIRS): %s\n", path)
+	}
+	prompt, err := cfg.SystemPrompt(data, *structured)
+	if err != nil {
+		return err
+	}
+	fmt.Println(prompt)
+	return nil
+}